@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/baba2k/echo-keycloak"
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+// loadtest sends requests with valid tokens to a route protected by the echo-keycloak
+// middlewares against a mock Keycloak server and reports throughput and latencies.
+func main() {
+	requests := flag.Int("n", 10000, "number of requests")
+	concurrency := flag.Int("c", 16, "number of concurrent clients")
+	tokens := flag.Int("tokens", 100, "number of distinct tokens")
+	cacheSize := flag.Int("cache", 0, "validation cache size, 0 disables the cache")
+	chain := flag.Bool("chain", false, "chain client roles, groups and extract roles middlewares")
+	flag.Parse()
+	if *requests < 0 {
+		log.Fatalf("invalid number of requests %d", *requests)
+	}
+
+	kc := keycloaktest.NewServer("test")
+	defer kc.Close()
+
+	e := echo.New()
+	config := keycloak.DefaultKeycloakConfig
+	config.KeycloakURL = kc.URL
+	config.KeycloakRealm = kc.Realm
+	config.ValidationCacheSize = *cacheSize
+	middlewares := []echo.MiddlewareFunc{keycloak.KeycloakWithConfig(config), keycloak.KeycloakRoles([]string{"user"})}
+	if *chain {
+		clientRoles := keycloak.DefaultKeycloakRolesConfig
+		clientRoles.KeycloakRoles = []string{"reader"}
+		clientRoles.RoleSource = keycloak.RealmAndClientRoles
+		clientRoles.ClientID = "api"
+		middlewares = append(middlewares,
+			keycloak.KeycloakRolesWithConfig(clientRoles),
+			keycloak.KeycloakGroups([]string{"/staff"}),
+			keycloak.KeycloakExtractRoles(),
+		)
+	}
+	e.GET("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, middlewares...)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	signed := make([]string, *tokens)
+	for i := range signed {
+		signed[i] = kc.Token(jwt.MapClaims{
+			"sub":             fmt.Sprintf("user-%d", i),
+			"realm_access":    map[string]interface{}{"roles": []string{"user"}},
+			"resource_access": map[string]interface{}{"api": map[string]interface{}{"roles": []string{"reader"}}},
+			"groups":          []string{"/staff"},
+			"scope":           "openid profile",
+		})
+	}
+
+	latencies := make([]time.Duration, *requests)
+	failures := 0
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	start := time.Now()
+	for w := 0; w < *concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+signed[i%len(signed)])
+				t := time.Now()
+				resp, err := http.DefaultClient.Do(req)
+				latencies[i] = time.Since(t)
+				if err != nil || resp.StatusCode != http.StatusNoContent {
+					mu.Lock()
+					failures++
+					mu.Unlock()
+				}
+				if err == nil {
+					resp.Body.Close()
+				}
+			}
+		}()
+	}
+	for i := 0; i < *requests; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) time.Duration {
+		if len(latencies) == 0 {
+			return 0
+		}
+		return latencies[int(p*float64(len(latencies)-1))]
+	}
+	fmt.Printf("requests: %d, failures: %d, elapsed: %v, throughput: %.0f req/s\n",
+		*requests, failures, elapsed, float64(*requests)/elapsed.Seconds())
+	fmt.Printf("latency p50: %v, p90: %v, p99: %v\n", percentile(0.5), percentile(0.9), percentile(0.99))
+}
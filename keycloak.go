@@ -1,14 +1,27 @@
 package keycloak
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
-	"reflect"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/Nerzal/gocloak/v5"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/labstack/gommon/log"
 )
 
 type (
@@ -17,9 +30,20 @@ type (
 		// Skipper defines a function to skip middleware.
 		Skipper middleware.Skipper
 
+		// SkipDefaultRoutes additionally skips OPTIONS requests and the paths in
+		// `DefaultSkipPaths` (health, metrics and favicon routes).
+		// Optional. Default value false.
+		SkipDefaultRoutes bool
+
 		// BeforeFunc defines a function which is executed just before the middleware.
 		BeforeFunc middleware.BeforeFunc
 
+		// ExtractBeforeSkipper extracts the token before Skipper and BeforeFunc are
+		// executed, which may read the result with `ExtractedToken()`, e.g. to skip
+		// the middleware only for requests without token.
+		// Optional. Default value false.
+		ExtractBeforeSkipper bool
+
 		// SuccessHandler defines a function which is executed for a valid token.
 		SuccessHandler KeycloakSuccessHandler
 
@@ -30,20 +54,231 @@ type (
 		// ErrorHandlerWithContext is almost identical to ErrorHandler, but it's passed the current context.
 		ErrorHandlerWithContext KeycloakErrorHandlerWithContext
 
+		// MessageCatalog translates error messages into the language requested by
+		// the Accept-Language header. It is only used if neither ErrorHandler nor
+		// ErrorHandlerWithContext is set.
+		// Optional. See `MapMessageCatalog()`.
+		MessageCatalog KeycloakMessageCatalog
+
+		// ErrorBody defines the response body of errors, e.g. a brand-consistent
+		// JSON envelope. It is only used if neither ErrorHandler nor
+		// ErrorHandlerWithContext is set.
+		// Optional. Default body is {"message": "<error message>"}.
+		ErrorBody KeycloakErrorBodyFunc
+
+		// Negotiate renders errors as JSON, HTML or plain text depending on the
+		// Accept header of the request. It is only used if neither ErrorHandler
+		// nor ErrorHandlerWithContext is set.
+		// Optional.
+		Negotiate *NegotiateConfig
+
 		// KeycloakURL defines the URL of the KeycloakRoles server.
 		KeycloakURL string
 
+		// AllowInsecure allows plain-HTTP Keycloak URLs for hosts other than localhost.
+		// Tokens are sent in plaintext to such servers, so it should only be set in
+		// development environments.
+		// Optional. Default value false.
+		AllowInsecure bool
+
 		// KeycloakRealm defines the realm of the KeycloakRoles server.
 		KeycloakRealm string
 
-		// Context key to store user information from the token into context.
+		// IssuerURL is the issuer URL of the realm, e.g.
+		// "https://sso.example.com/realms/demo". If set, it replaces KeycloakURL,
+		// BasePath and KeycloakRealm, and the endpoints of the realm are resolved
+		// from its OIDC discovery document (/.well-known/openid-configuration) when
+		// the middleware is created. See `Verifier.Endpoints()`.
+		// Optional.
+		IssuerURL string
+
+		// BasePath is the path of Keycloak below KeycloakURL. Keycloak 17 and newer
+		// (Quarkus) serve realms without the "/auth" prefix of older (WildFly)
+		// versions, which requires BasePath "/".
+		// Optional. Default value "/auth".
+		BasePath string
+
+		// DetectBasePath probes KeycloakURL for the realm with and without the "/auth"
+		// prefix when the middleware is created and uses the base path found. If the
+		// realm cannot be found, BasePath is used.
+		// Optional. Default value false.
+		DetectBasePath bool
+
+		// LegacyIssuers maps issuer URLs used before a migration of the realm, e.g. a
+		// renamed realm or a new base URL, to the current realm, so tokens minted before
+		// the migration keep validating during a transition window. The entries should
+		// be removed once all legacy tokens expired.
+		// Optional.
+		LegacyIssuers map[string]string
+
+		// ValidateIssuer rejects tokens whose iss claim is neither the issuer of the
+		// realm at KeycloakURL nor one of TrustedIssuers or LegacyIssuers, e.g. tokens
+		// of other realms or spoofed issuers.
+		// Optional. Default value false.
+		ValidateIssuer bool
+
+		// TrustedIssuers are additional issuer URLs accepted by ValidateIssuer, e.g.
+		// the public URL of the realm if KeycloakURL is an internal URL.
+		// Optional.
+		TrustedIssuers []string
+
+		// ClientID defines the client id of the confidential client of this service.
+		// Optional.
+		ClientID string
+
+		// ClientSecret defines the client secret of the confidential client of this service.
+		// Optional.
+		ClientSecret string
+
+		// ClientAssertionKey enables authenticating the client with signed JWT client
+		// assertions (private_key_jwt) instead of ClientSecret at the token and
+		// introspection endpoints of Keycloak.
+		// Optional.
+		ClientAssertionKey *rsa.PrivateKey
+
+		// ClientAssertionKeyID defines the key id of ClientAssertionKey registered at the client.
+		// Optional.
+		ClientAssertionKeyID string
+
+		// Context key to store user information from the token into context. The
+		// token is read-only with ValidationCacheSize.
 		// Optional. Default value "user".
 		ContextKey string
 
+		// TokenFunc defines a function which is executed after BeforeFunc, or before
+		// Skipper with ExtractBeforeSkipper, and may return the token of the request
+		// instead of TokenLookup.
+		// Optional.
+		TokenFunc KeycloakTokenFunc
+
+		// PreFilter is executed for every extracted token before it is decoded or
+		// looked up in caches and may reject obviously bogus tokens without any
+		// cryptography, reducing CPU usage under attack traffic. Rejected tokens are
+		// handled like invalid tokens. See `TokenPreFilter()`.
+		// Optional.
+		PreFilter KeycloakPreFilter
+
+		// ContextValue defines the value stored under ContextKey.
+		// Optional. Default value TokenContextValue.
+		ContextValue ContextValue
+
+		// ContextMode defines whether the legacy context values, i.e. the token under
+		// ContextKey and the roles under RolesContextKey of roles middlewares, the
+		// structured AuthContext or both are stored. See `AuthFromContext()`.
+		// Optional. Default value LegacyContext.
+		ContextMode ContextMode
+
+		// AllowedAlgorithms defines the signing algorithms accepted in the alg header
+		// of tokens. RS*, PS* and ES* algorithms of RSA and EC realm keys are
+		// supported, tokens with other algorithms like "none" or HS256 are rejected.
+		// Optional. Default value []string{"RS256"}.
+		AllowedAlgorithms []string
+
+		// RequiredAudience rejects tokens whose aud claim contains none of the given
+		// audiences, e.g. the client id of this API, so tokens issued for other clients
+		// of the realm do not grant access.
+		// Optional. Default value nil, the aud claim is not checked.
+		RequiredAudience []string
+
+		// AudienceResolver returns the audiences expected for the route of the request,
+		// so one middleware of a gateway can protect several APIs. Tokens whose aud
+		// claim contains none of them are rejected. No audiences are checked if it
+		// returns none. See `RouteAudiences()`.
+		// Optional.
+		AudienceResolver func(c echo.Context) []string
+
+		// AllowedAuthorizedParties rejects tokens whose azp claim, the client the token
+		// was issued to, is not one of the given client ids.
+		// Optional. Default value nil, the azp claim is not checked.
+		AllowedAuthorizedParties []string
+
+		// AllowedTokenTypes defines the accepted values of the typ claim, rejecting
+		// refresh and ID tokens of the realm presented as access tokens. Tokens
+		// without a typ claim are rejected unless AllowMissingTokenType is set. Claims
+		// types other than jwt.MapClaims therefore need a typ field.
+		// Optional. Default value []string{TokenTypeBearer}.
+		AllowedTokenTypes []string
+
+		// AllowMissingTokenType accepts tokens without a typ claim, e.g. of issuers
+		// other than Keycloak. Tokens with a typ claim must still match
+		// AllowedTokenTypes.
+		// Optional. Default value false.
+		AllowMissingTokenType bool
+
+		// ValidationMode defines how tokens are validated.
+		// Optional. Default value LocalValidation.
+		ValidationMode ValidationMode
+
+		// StaticJWKS is a JSON web key set, e.g. read from a file, used instead of the
+		// keys of the realm fetched from Keycloak, so tokens are verified without
+		// connectivity to Keycloak, e.g. in air-gapped deployments or tests. Only
+		// LocalValidation is supported, KeycloakURL is optional.
+		// Optional.
+		StaticJWKS []byte
+
+		// StaticPublicKeys are PEM encoded public keys or certificates by key id used
+		// like StaticJWKS, also with it. The key id "" matches tokens without kid.
+		// Optional.
+		StaticPublicKeys map[string][]byte
+
+		// EagerInit fetches the signing keys of the realm when the middleware is
+		// created, panicking if the realm does not exist or has no keys, so
+		// misconfiguration fails at startup instead of as 401 responses. See
+		// `SelfTest()` for more checks returning an error.
+		// Optional. Default value false.
+		EagerInit bool
+
+		// SharedKeys shares the public keys of the realm with all middlewares of this
+		// process with SharedKeys and the same certs endpoint, e.g. of multiple route
+		// groups, so the keys are stored and fetched once. Middlewares created later
+		// start with the keys already fetched. The keys are fetched with the HTTP
+		// client, TokenCache, KeysMaxAge and KeyRefetchInterval of the first
+		// middleware. The keys are released when all verifiers sharing them are
+		// closed, see `Verifier.Close()`. It has no effect with static keys.
+		// Optional. Default value false.
+		SharedKeys bool
+
+		// KeysMaxAge is the duration the public keys of the realm are cached for
+		// LocalValidation. Keys with unknown key ids are fetched immediately, e.g.
+		// after a key rotation.
+		// Optional. Default value 10 minutes.
+		KeysMaxAge time.Duration
+
+		// KeyRefetchInterval is the minimum interval between fetches of the public
+		// keys triggered by tokens with unknown key ids or after a failed fetch. Tokens
+		// with unknown key ids are rejected without fetch within the interval. Fetches
+		// are counted in `Stats()`.
+		// Optional. Default value 10 seconds.
+		KeyRefetchInterval time.Duration
+
+		// KeyRefreshInterval enables refreshing the public keys of the realm in the
+		// background for LocalValidation, so requests don't wait for a fetch after a
+		// key rotation. It is at least KeyRefetchInterval. The refresh is stopped by
+		// `Close()`.
+		// Optional. Default value 0 (disabled).
+		KeyRefreshInterval time.Duration
+
+		// SweepInterval enables removing expired entries of the in-memory session
+		// stores and caches of the middleware in the background, e.g. of sessions
+		// never seen again, which are otherwise only removed when new entries are
+		// added. Removed entries are counted in `Stats()`. The sweep is stopped by
+		// `Close()`.
+		// Optional. Default value 0 (disabled).
+		SweepInterval time.Duration
+
 		// Claims are extendable claims data defining token content.
 		// Optional. Default value jwt.MapClaims
+		//
+		// Deprecated: Use NewClaimsFunc. Claims is only used without NewClaimsFunc and
+		// must be jwt.MapClaims or a pointer to a struct.
 		Claims jwt.Claims
 
+		// NewClaimsFunc returns a new claims instance the token of a request is decoded
+		// into, e.g. func() jwt.Claims { return &MyClaims{} }. It is called for every
+		// validated token, so instances are never shared between requests.
+		// Optional. Default value returns claims of the type of Claims.
+		NewClaimsFunc func() jwt.Claims
+
 		// TokenLookup is a string in the form of "<source>:<name>" that is used
 		// to extract token from the request.
 		// Optional. Default value "header:Authorization".
@@ -51,14 +286,299 @@ type (
 		// - "header:<name>"
 		// - "query:<name>"
 		// - "param:<name>"
-		// - "cookie:<name>"
+		// - "cookie:<name>" or "cookie:<name>|<fallback name>"
+		// - "body:<name>" (field of a JSON request body)
 		TokenLookup string
 
+		// MaxTokenBodySize is the maximum size of request bodies read by "body" token
+		// lookups before the token is validated. Larger bodies are rejected with
+		// ErrTokenBodyTooLarge.
+		// Optional. Default value 64 KB.
+		MaxTokenBodySize int64
+
+		// CookieSignatureSecret enables verifying tokens of "cookie" lookups with an
+		// HMAC-SHA256 signature of the token, e.g. set by a gateway. The signature is
+		// read from the cookie named like the token cookie with CookieSignatureSuffix
+		// and may be base64url or hex encoded.
+		// Optional.
+		CookieSignatureSecret []byte
+
+		// CookieSignatureSuffix is appended to the token cookie name to get the name
+		// of the signature cookie.
+		// Optional. Default value ".sig".
+		CookieSignatureSuffix string
+
+		// UnauthorizedOnMissingToken returns ErrTokenMissingUnauthorized ("401 - Unauthorized")
+		// with a WWW-Authenticate header for missing tokens as expected by RFC 6750,
+		// instead of ErrTokenMissing ("400 - Bad Request").
+		// Optional. Default value false.
+		UnauthorizedOnMissingToken bool
+
+		// TrustedTokenHeader defines a header, e.g. "X-Forwarded-Access-Token", whose
+		// token is trusted without verifying its signature if the request comes from a
+		// trusted gateway, see TrustedProxies and TrustedPeer. The time claims are still
+		// validated. Other requests and requests without the header use TokenLookup.
+		// Optional.
+		TrustedTokenHeader string
+
+		// TrustedProxies defines the CIDRs of gateways trusted for TrustedTokenHeader.
+		// The direct peer address of the request is checked, not forwarding headers.
+		// Optional.
+		TrustedProxies []string
+
+		// TrustedPeer defines a function reporting whether the request comes from a
+		// gateway trusted for TrustedTokenHeader, e.g. by its mTLS client certificate.
+		// Optional.
+		TrustedPeer func(*http.Request) bool
+
+		// DisallowURLTokens forbids tokens in URLs, e.g. to comply with security policies.
+		// Configuring a "query" or "param" TokenLookup panics if set.
+		// Optional. Default value false.
+		DisallowURLTokens bool
+
 		// AuthScheme to be used in the Authorization header.
 		// Optional. Default value "Bearer".
 		AuthScheme string
 
-		gocloakClient gocloak.GoCloak
+		// StrictAuthScheme requires the Authorization header to be exactly the
+		// case-sensitive AuthScheme, a single space and a token made of
+		// base64url characters and dots. Anything else is rejected with
+		// ErrTokenMalformed.
+		// Optional. Default value false.
+		StrictAuthScheme bool
+
+		// DuplicateHeaders defines how requests with multiple token headers, e.g. two
+		// Authorization headers, are handled.
+		// Optional. Default value RejectDuplicateHeaders.
+		DuplicateHeaders DuplicateHeaderMode
+
+		// OneTimeQueryTokens accepts tokens from query lookups only once, e.g. for
+		// pre-signed download links. Such tokens must have a jti claim and must expire
+		// within OneTimeTokenMaxAge. Used tokens are recorded in the TokenCache if set,
+		// so they are shared by all instances, and in memory otherwise.
+		// Optional. Default value false.
+		OneTimeQueryTokens bool
+
+		// OneTimeTokenMaxAge is the maximum remaining lifetime of one-time tokens.
+		// Optional. Default value 5 minutes.
+		OneTimeTokenMaxAge time.Duration
+
+		// ClaimsTransformers are applied in order to the claims of valid tokens, before
+		// they are stored in context and checked by other middlewares. Only jwt.MapClaims
+		// are transformed. See `RenameClaim()`, `FlattenClaim()` and `DeriveClaim()`.
+		// Optional.
+		ClaimsTransformers []ClaimsTransformer
+
+		// ClaimsDecoder decodes the JSON claims of tokens, e.g. to use a faster JSON
+		// library than encoding/json.
+		// Optional. Default value json.Unmarshal.
+		ClaimsDecoder func(data []byte, v interface{}) error
+
+		// Now defines the time source used to validate the exp, iat and nbf claims.
+		// Optional. Default value time.Now.
+		Now func() time.Time
+
+		// Leeway is the tolerated clock difference when validating the exp, iat and
+		// nbf claims: tokens are accepted up to Leeway after they expired and up to
+		// Leeway before they were issued or become valid.
+		// Optional. Default value 0.
+		Leeway time.Duration
+
+		// MaxClockSkew is the maximum difference between the local time and the time of
+		// the Keycloak server before a warning is logged and counted in `Stats()`.
+		// Optional. Default value Leeway plus one second, the resolution of the Date
+		// header, as larger clock skews cause fresh tokens to be rejected.
+		MaxClockSkew time.Duration
+
+		// Logger is used to log warnings.
+		// Optional. Default logger prefix is "echo-keycloak".
+		Logger echo.Logger
+
+		// ValidationCacheSize is the maximum number of validated tokens of LocalValidation
+		// which are cached until they expire, so repeated requests with the same token skip decoding
+		// and signature verification. Cache hits reuse the cached token and its claims
+		// without allocating, so they are shared between requests and read-only:
+		// handlers and middlewares must not modify the token or its claims, including
+		// nested maps and slices, but modify a copy. ClaimsTransformers run before
+		// tokens are cached.
+		// Optional. Default value 0 (disabled).
+		ValidationCacheSize int
+
+		// IntrospectionCacheSize is the maximum number of introspection results of
+		// IntrospectionValidation which are cached for IntrospectionCacheTTL, both of
+		// active and inactive tokens. Revoked tokens are accepted until their cached
+		// result expires. Cached tokens are shared between requests and must not be
+		// modified by handlers.
+		// Optional. Default value 0 (disabled).
+		IntrospectionCacheSize int
+
+		// IntrospectionCacheTTL is the duration introspection results are cached.
+		// Optional. Default value 10 seconds.
+		IntrospectionCacheTTL time.Duration
+
+		// IntrospectionCacheMaxTTL enables the Cache-Control header of introspection
+		// responses: results are cached for its max-age, but at most for
+		// IntrospectionCacheMaxTTL, and not at all for no-store or no-cache. Responses
+		// without max-age are cached for IntrospectionCacheTTL.
+		// Optional. Default value 0, the Cache-Control header is ignored.
+		IntrospectionCacheMaxTTL time.Duration
+
+		// TokenCache is a cache shared by multiple instances of a service, e.g. of
+		// `NewRedisCache()`, or an in-memory cache of `NewMemoryCache()` limiting the
+		// memory used. It caches the public keys of the realm for KeysMaxAge and
+		// introspection results for IntrospectionCacheTTL. Signatures of tokens are
+		// always verified locally, as that is cheaper than a cache lookup.
+		// Optional.
+		TokenCache TokenCache
+
+		// ClaimsChangedHandler defines a function which is executed when a refreshed
+		// token of a Keycloak session (sid claim) has different claims than the previous
+		// token of the session, e.g. to invalidate cached permissions after role changes.
+		// Sessions are tracked for SessionTTL.
+		// Optional.
+		ClaimsChangedHandler KeycloakClaimsChangedHandler
+
+		// SessionTTL is the duration the claims of a session are tracked for
+		// ClaimsChangedHandler after its latest request.
+		// Optional. Default value 1 hour.
+		SessionTTL time.Duration
+
+		// Revocation rejects tokens revoked with `Verifier.RevokeToken()` and tokens
+		// of sessions revoked with `Verifier.RevokeSession()` or logged out by Keycloak
+		// at the endpoints of `KeycloakAdapterAdmin()`, even if they are valid.
+		// Revocations are stored in memory and in the TokenCache if set, so they are
+		// shared by all instances. Tokens are rejected if the revocations of the
+		// TokenCache cannot be looked up, see `CheckedTokenCache`.
+		// Optional. Default value false.
+		Revocation bool
+
+		// RevocationTTL is the duration revoked sessions are rejected for. It should
+		// cover the lifetime of the tokens of a session, e.g. the SSO Session Max of
+		// the realm. Revoked tokens are rejected until they expire.
+		// Optional. Default value 10 hours.
+		RevocationTTL time.Duration
+
+		// HTTPClient is used for all requests to Keycloak, e.g. with a custom transport.
+		// It is copied, so the timeouts, circuit breaker and limiter of the verifier
+		// do not apply to other users of the client.
+		// Optional. Default value is a client of resty.
+		HTTPClient *http.Client
+
+		// TLSConfig is used for connections to Keycloak, e.g. with RootCAs of a
+		// corporate PKI or a client certificate for mutual TLS. InsecureSkipVerify
+		// requires AllowInsecure. It is only applied to transports of type
+		// *http.Transport.
+		// Optional.
+		TLSConfig *tls.Config
+
+		// ProxyURL is the URL of the proxy used for requests to Keycloak, e.g.
+		// "http://proxy:3128" or "socks5://proxy:1080". It is only applied to
+		// transports of type *http.Transport.
+		// Optional. Default value "" (the HTTPS_PROXY, HTTP_PROXY and NO_PROXY
+		// environment variables are honored).
+		ProxyURL string
+
+		// RequestTimeout limits each request to Keycloak including reading the
+		// response, bounding how long requests wait for Keycloak.
+		// Optional. Default value 10 seconds.
+		RequestTimeout time.Duration
+
+		// ConnectTimeout limits establishing connections to Keycloak. It is only
+		// applied to transports of type *http.Transport.
+		// Optional. Default value 0 (timeout of the transport).
+		ConnectTimeout time.Duration
+
+		// CircuitBreaker enables a circuit breaker for all requests to Keycloak, so
+		// requests fail fast while Keycloak is down instead of waiting for timeouts.
+		// Failing requests are handled according to FailureMode.
+		// Optional. Default value nil (disabled).
+		CircuitBreaker *CircuitBreakerConfig
+
+		// MaxConcurrentRequests limits the concurrent requests to Keycloak. Requests
+		// exceeding the limit fail immediately and are handled according to
+		// FailureMode. As every verifier has its own client, circuit breaker and
+		// limit, verifiers of different realms sharing a Keycloak do not degrade
+		// each other if one realm is slow or down.
+		// Optional. Default value 0 (unlimited).
+		MaxConcurrentRequests int
+
+		// FailureMode defines the behavior if Keycloak is unreachable or responds with "5xx".
+		// Optional. Default value FailWithCachedKeys.
+		FailureMode FailureMode
+
+		// IntrospectionFallback validates tokens of IntrospectionValidation locally
+		// with the public keys of the realm if the introspection endpoint is
+		// unavailable and FailureMode is FailWithCachedKeys. Revoked and logged out
+		// tokens are accepted during such an outage. The keys are fetched in the
+		// background when the middleware is created.
+		// Optional. Default value false, tokens which cannot be introspected are
+		// rejected.
+		IntrospectionFallback bool
+
+		// RetryAfter is sent as Retry-After header with "503 - Service Unavailable"
+		// errors if Keycloak is unreachable or responds with "5xx", instead of
+		// rejecting valid tokens with "401 - Unauthorized".
+		// Optional. Default value 30 seconds.
+		RetryAfter time.Duration
+
+		// IdentityContextKey enables storing the normalized identity (subject, client
+		// and tenant) of valid tokens into context as Identity, e.g. for identity
+		// based rate limiting with `IdentityExtractor()`.
+		// Optional. Default value "" (disabled).
+		IdentityContextKey string
+
+		// UserInfoContextKey enables fetching the userinfo of valid tokens from Keycloak
+		// and stores it into context as *gocloak.UserInfo. The userinfo is memoized
+		// per Keycloak session (sid claim) for UserInfoTTL.
+		// Optional. Default value "" (disabled).
+		UserInfoContextKey string
+
+		// UserInfoTTL is the duration the userinfo of a session is memoized.
+		// Optional. Default value 1 minute.
+		UserInfoTTL time.Duration
+
+		// RequireActiveSession checks that the Keycloak session (sid or session_state
+		// claim) of valid tokens is still active at the userinfo endpoint, so tokens
+		// of terminated SSO sessions are rejected before they expire. The result is
+		// memoized per session for ActiveSessionTTL. Tokens without session are
+		// rejected.
+		// Optional. Default value false.
+		RequireActiveSession bool
+
+		// ActiveSessionTTL is the duration the state of a session is memoized for
+		// RequireActiveSession. Terminated sessions are detected with this delay.
+		// Optional. Default value 30 seconds.
+		ActiveSessionTTL time.Duration
+
+		// Enricher loads additional data of valid tokens, e.g. roles of the admin API,
+		// and stores it into context under EnrichmentContextKey. Results are memoized
+		// per Keycloak session (sid claim) for EnrichmentTTL, so refreshed tokens of
+		// the same session reuse them.
+		// Optional.
+		Enricher KeycloakEnricher
+
+		// EnrichmentContextKey is the context key which stores the result of Enricher.
+		// Optional. Default value "enrichment".
+		EnrichmentContextKey string
+
+		// EnrichmentTTL is the duration the result of Enricher is memoized per session.
+		// Optional. Default value 5 minutes.
+		EnrichmentTTL time.Duration
+
+		gocloakClient      gocloak.GoCloak
+		allowedAlgorithms  map[string]struct{}
+		trustedIssuers     map[string]struct{}
+		endpoints          *OIDCEndpoints
+		usedTokens         *usedTokens
+		validationCache    *validationCache
+		introspectionCache *introspectionCache
+		keySet             *keySet
+		userInfoMemo       *sessionMemo
+		enrichmentMemo     *sessionMemo
+		activeSessions     *sessionMemo
+		sessionClaims      *sessionClaims
+		revocations        *revocations
+		trustedUpstream    *trustedUpstream
 	}
 
 	// KeycloakSuccessHandler defines a function which is executed for a valid token.
@@ -70,22 +590,122 @@ type (
 	// KeycloakErrorHandlerWithContext is almost identical to KeycloakErrorHandler, but it's passed the current context.
 	KeycloakErrorHandlerWithContext func(error, echo.Context) error
 
+	// KeycloakEnricher returns additional data of a valid token, see `KeycloakConfig.Enricher`.
+	KeycloakEnricher func(c echo.Context, token *jwt.Token) (interface{}, error)
+
+	// KeycloakTokenFunc returns the token of the request, e.g. from a signed request envelope.
+	// If it returns an empty token without error, the token is extracted with TokenLookup.
+	KeycloakTokenFunc func(echo.Context) (string, error)
+
+	// KeycloakPreFilter returns an error for tokens which are obviously invalid.
+	KeycloakPreFilter func(token string) error
+
+	// ContextValue defines the value the Keycloak middleware stores in context.
+	ContextValue int
+
+	// ValidationMode defines how the Keycloak middleware validates tokens.
+	ValidationMode string
+
+	// FailureMode defines how the Keycloak middleware behaves if Keycloak is unavailable.
+	FailureMode int
+
+	// DuplicateHeaderMode defines how the Keycloak middleware handles requests with
+	// multiple token headers.
+	DuplicateHeaderMode int
+
 	tokenExtractor func(echo.Context) (string, error)
 )
 
+// Failure modes
+const (
+	// FailWithCachedKeys validates tokens with the cached public keys of the realm,
+	// even if they are older than KeysMaxAge, and tokens of IntrospectionValidation
+	// locally if IntrospectionFallback is set. Otherwise, it responds "503 - Service
+	// Unavailable".
+	FailWithCachedKeys FailureMode = iota
+
+	// FailUnavailable responds "503 - Service Unavailable" with a Retry-After header
+	// if the keys or introspection results cannot be fetched.
+	FailUnavailable
+
+	// FailClosed responds "401 - Unauthorized" like for invalid tokens, denying all
+	// requests which cannot be validated.
+	FailClosed
+)
+
+// Duplicate header handling
+const (
+	// RejectDuplicateHeaders rejects requests with multiple token headers with
+	// ErrTokenAmbiguous, as it is unclear which token is meant.
+	RejectDuplicateHeaders DuplicateHeaderMode = iota
+
+	// FirstDuplicateHeader uses the first of multiple token headers.
+	FirstDuplicateHeader
+
+	// LastDuplicateHeader uses the last of multiple token headers.
+	LastDuplicateHeader
+)
+
+// Validation modes
+const (
+	// LocalValidation verifies the signature of tokens with the public keys of the
+	// realm (JWKS), which are fetched once and cached for KeysMaxAge. Tokens are
+	// validated without a request to Keycloak.
+	LocalValidation ValidationMode = "local"
+
+	// IntrospectionValidation validates tokens with the introspection endpoint of
+	// Keycloak (RFC 7662) on every request, e.g. opaque tokens or tokens revoked by
+	// Keycloak. It requires ClientID and ClientSecret or ClientAssertionKey of a
+	// client permitted to introspect tokens.
+	IntrospectionValidation ValidationMode = "introspection"
+)
+
+// Context values
+const (
+	// TokenContextValue stores the *jwt.Token.
+	TokenContextValue ContextValue = iota
+
+	// ClaimsContextValue stores the claims of the token, i.e. jwt.MapClaims or the type returned by NewClaimsFunc.
+	ClaimsContextValue
+)
+
 // Errors
 var (
-	ErrTokenMissing = echo.NewHTTPError(http.StatusBadRequest, "missing or malformed token")
+	ErrTokenMissing             = echo.NewHTTPError(http.StatusBadRequest, "missing or malformed token")
+	ErrTokenMissingUnauthorized = echo.NewHTTPError(http.StatusUnauthorized, "missing or malformed token")
+	ErrTokenMalformed           = echo.NewHTTPError(http.StatusBadRequest, "malformed token")
+	ErrTokenAmbiguous           = echo.NewHTTPError(http.StatusBadRequest, "multiple token headers")
+	ErrCookieSignatureInvalid   = echo.NewHTTPError(http.StatusUnauthorized, "invalid cookie signature")
+	ErrTokenBodyTooLarge        = echo.NewHTTPError(http.StatusRequestEntityTooLarge, "request body too large")
 )
 
 var (
 	// DefaultKeycloakRolesConfig is the default KeycloakRoles auth middleware config.
 	DefaultKeycloakConfig = KeycloakConfig{
-		Skipper:     middleware.DefaultSkipper,
-		ContextKey:  "user",
-		TokenLookup: "header:" + echo.HeaderAuthorization,
-		AuthScheme:  "Bearer",
-		Claims:      jwt.MapClaims{},
+		Skipper:               middleware.DefaultSkipper,
+		ContextKey:            "user",
+		TokenLookup:           "header:" + echo.HeaderAuthorization,
+		AuthScheme:            "Bearer",
+		Claims:                jwt.MapClaims{},
+		OneTimeTokenMaxAge:    5 * time.Minute,
+		MaxTokenBodySize:      64 << 10,
+		ClaimsDecoder:         json.Unmarshal,
+		Now:                   time.Now,
+		CookieSignatureSuffix: ".sig",
+		UserInfoTTL:           time.Minute,
+		ActiveSessionTTL:      30 * time.Second,
+		ValidationMode:        LocalValidation,
+		AllowedAlgorithms:     []string{"RS256"},
+		AllowedTokenTypes:     []string{TokenTypeBearer},
+		KeysMaxAge:            10 * time.Minute,
+		KeyRefetchInterval:    10 * time.Second,
+		IntrospectionCacheTTL: 10 * time.Second,
+		RequestTimeout:        10 * time.Second,
+		EnrichmentContextKey:  "enrichment",
+		EnrichmentTTL:         5 * time.Minute,
+		SessionTTL:            time.Hour,
+		RevocationTTL:         10 * time.Hour,
+		RetryAfter:            30 * time.Second,
 	}
 )
 
@@ -106,51 +726,343 @@ func Keycloak(url, realm string) echo.MiddlewareFunc {
 // KeycloakRolesWithConfig returns a KeycloakRoles auth middleware with config.
 // See: `KeycloakRoles()`.
 func KeycloakWithConfig(config KeycloakConfig) echo.MiddlewareFunc {
+	return NewVerifier(config).Middleware()
+}
+
+// NewVerifier returns a Verifier validating tokens with config. It panics on
+// misconfiguration like `KeycloakWithConfig()`.
+func NewVerifier(config KeycloakConfig) *Verifier {
+	v := &Verifier{stop: make(chan struct{})}
+
 	// Defaults
 	if config.Skipper == nil {
 		config.Skipper = DefaultKeycloakConfig.Skipper
 	}
-	if config.KeycloakURL == "" {
+	if config.SkipDefaultRoutes {
+		config.Skipper = withDefaultRoutes(config.Skipper)
+	}
+	if config.IssuerURL != "" {
+		config.KeycloakURL, config.BasePath, config.KeycloakRealm = splitIssuerURL(config.IssuerURL)
+		config.DetectBasePath = false
+	}
+	if config.KeycloakURL == "" && config.StaticJWKS == nil && config.StaticPublicKeys == nil {
 		panic("echo: keycloak middleware requires keycloak url")
 	}
+	if len(config.LegacyIssuers) > 0 {
+		legacy := make(map[string]string, len(config.LegacyIssuers))
+		for iss, realm := range config.LegacyIssuers {
+			if realm == "" {
+				panic("echo: keycloak middleware requires a realm for legacy issuer " + iss)
+			}
+			legacy[strings.TrimRight(iss, "/")] = realm
+		}
+		config.LegacyIssuers = legacy
+	}
 	if config.ContextKey == "" {
 		config.ContextKey = DefaultKeycloakConfig.ContextKey
 	}
 	if config.Claims == nil {
 		config.Claims = DefaultKeycloakConfig.Claims
 	}
+	if config.NewClaimsFunc == nil {
+		config.NewClaimsFunc = claimsFactory(config.Claims)
+	}
 	if config.TokenLookup == "" {
 		config.TokenLookup = DefaultKeycloakConfig.TokenLookup
 	}
 	if config.AuthScheme == "" {
 		config.AuthScheme = DefaultKeycloakConfig.AuthScheme
 	}
-	config.gocloakClient = gocloak.NewClient(config.KeycloakURL)
+	if config.CookieSignatureSuffix == "" {
+		config.CookieSignatureSuffix = DefaultKeycloakConfig.CookieSignatureSuffix
+	}
+	if config.MaxTokenBodySize == 0 {
+		config.MaxTokenBodySize = DefaultKeycloakConfig.MaxTokenBodySize
+	}
+	if config.OneTimeTokenMaxAge == 0 {
+		config.OneTimeTokenMaxAge = DefaultKeycloakConfig.OneTimeTokenMaxAge
+	}
+	if config.ClaimsDecoder == nil {
+		config.ClaimsDecoder = DefaultKeycloakConfig.ClaimsDecoder
+	}
+	if config.Now == nil {
+		config.Now = DefaultKeycloakConfig.Now
+	}
+	if config.Leeway < 0 {
+		panic("echo: keycloak middleware requires a non-negative leeway")
+	}
+	if config.MaxClockSkew == 0 {
+		config.MaxClockSkew = config.Leeway + clockSkewResolution
+	}
+	if config.Logger == nil {
+		config.Logger = log.New("echo-keycloak")
+	}
+	checkInsecureURL(config.KeycloakURL, config.AllowInsecure, config.Logger)
+	checkInsecureTLS(config.TLSConfig, config.AllowInsecure, config.Logger)
+	if config.RequestTimeout == 0 {
+		config.RequestTimeout = DefaultKeycloakConfig.RequestTimeout
+	}
+	config.gocloakClient = config.newGocloakClient()
+	watchClockSkew(config.gocloakClient.RestyClient(), config.MaxClockSkew, config.Logger)
+	if config.DetectBasePath && config.KeycloakURL != "" {
+		if basePath, err := config.detectBasePath(); err == nil {
+			config.BasePath = basePath
+		} else {
+			config.Logger.Warnf("could not detect base path of keycloak, using %q: %v", config.BasePath, err)
+		}
+	}
+	if config.IssuerURL != "" {
+		if endpoints, err := config.discover(); err == nil {
+			config.endpoints = endpoints
+		} else {
+			config.Logger.Warnf("could not discover endpoints of %s, using keycloak defaults: %v", config.IssuerURL, err)
+		}
+	}
+	if config.endpoints == nil {
+		endpoints := config.oidcEndpoints()
+		config.endpoints = &endpoints
+	}
+	if config.ValidateIssuer {
+		config.trustedIssuers = map[string]struct{}{strings.TrimRight(config.oidcEndpoints().Issuer, "/"): {}}
+		for _, iss := range config.TrustedIssuers {
+			config.trustedIssuers[strings.TrimRight(iss, "/")] = struct{}{}
+		}
+		for iss := range config.LegacyIssuers {
+			config.trustedIssuers[iss] = struct{}{}
+		}
+	}
+	if config.CircuitBreaker != nil {
+		restyClient := config.gocloakClient.RestyClient()
+		source := degradation.source(config.KeycloakURL)
+		v.release = append(v.release, func() {
+			degradation.remove(source)
+		})
+		restyClient.SetTransport(newCircuitBreaker(*config.CircuitBreaker, restyClient.GetClient().Transport, source))
+	}
+	if config.MaxConcurrentRequests > 0 {
+		restyClient := config.gocloakClient.RestyClient()
+		restyClient.SetTransport(newConcurrencyLimiter(config.MaxConcurrentRequests, restyClient.GetClient().Transport))
+	}
+	if len(config.AllowedTokenTypes) == 0 {
+		config.AllowedTokenTypes = DefaultKeycloakConfig.AllowedTokenTypes
+	}
+	if len(config.AllowedAlgorithms) == 0 {
+		config.AllowedAlgorithms = DefaultKeycloakConfig.AllowedAlgorithms
+	}
+	config.allowedAlgorithms = make(map[string]struct{}, len(config.AllowedAlgorithms))
+	for _, alg := range config.AllowedAlgorithms {
+		if !supportedAlgorithm(alg) {
+			panic("echo: keycloak middleware does not support signing algorithm " + alg)
+		}
+		config.allowedAlgorithms[alg] = struct{}{}
+	}
+	if config.ValidationMode == "" {
+		config.ValidationMode = DefaultKeycloakConfig.ValidationMode
+	}
+	if config.ValidationMode != LocalValidation && config.ValidationMode != IntrospectionValidation {
+		panic("echo: keycloak middleware requires valid validation mode")
+	}
+	if config.ValidationMode == IntrospectionValidation && config.ClientID == "" {
+		panic("echo: keycloak middleware requires client id for introspection")
+	}
+	if config.KeysMaxAge == 0 {
+		config.KeysMaxAge = DefaultKeycloakConfig.KeysMaxAge
+	}
+	if config.KeyRefetchInterval == 0 {
+		config.KeyRefetchInterval = DefaultKeycloakConfig.KeyRefetchInterval
+	}
+	if config.KeyRefreshInterval > 0 && config.KeyRefreshInterval < config.KeyRefetchInterval {
+		config.KeyRefreshInterval = config.KeyRefetchInterval
+	}
+	fetchKeys := config.fetchCerts
+	static := config.StaticJWKS != nil || config.StaticPublicKeys != nil
+	if static {
+		if config.ValidationMode == IntrospectionValidation {
+			panic("echo: keycloak middleware does not support static keys for introspection")
+		}
+		keys, err := staticKeys(config.StaticJWKS, config.StaticPublicKeys)
+		if err != nil {
+			panic("echo: keycloak middleware requires valid static keys: " + err.Error())
+		}
+		fetchKeys = func(bool) (map[string]crypto.PublicKey, error) {
+			return keys, nil
+		}
+	}
+	newKeys := func() *keySet {
+		k := newKeySet(fetchKeys, config.KeysMaxAge, config.KeyRefetchInterval, config.FailureMode == FailWithCachedKeys)
+		k.degradation = degradation.source(config.oidcEndpoints().JWKS)
+		return k
+	}
+	if config.SharedKeys && !static {
+		var release func()
+		config.keySet, release = sharedKeySet(config.oidcEndpoints().JWKS, newKeys)
+		v.release = append(v.release, release)
+	} else {
+		config.keySet = newKeys()
+		keys := config.keySet
+		v.release = append(v.release, func() {
+			degradation.remove(keys.degradation)
+		})
+	}
+	background := false
+	if config.KeyRefreshInterval > 0 && config.ValidationMode == LocalValidation {
+		config.keySet.refreshEvery(config.KeyRefreshInterval, v.stop)
+		background = true
+	}
+	if config.EagerInit {
+		if err := config.keySet.load(); err != nil {
+			panic("echo: keycloak middleware failed to load keys of realm " + config.KeycloakRealm + ": " + err.Error())
+		}
+	} else if config.ValidationMode == IntrospectionValidation && config.introspectionFallback() {
+		// Fetch the keys in the background to validate tokens locally in case of an outage
+		config.keySet.refresh()
+	}
+	if config.UserInfoTTL == 0 {
+		config.UserInfoTTL = DefaultKeycloakConfig.UserInfoTTL
+	}
+	if config.UserInfoContextKey != "" {
+		config.userInfoMemo = newSessionMemo(config.UserInfoTTL)
+	}
+	if config.ActiveSessionTTL == 0 {
+		config.ActiveSessionTTL = DefaultKeycloakConfig.ActiveSessionTTL
+	}
+	if config.RequireActiveSession {
+		config.activeSessions = newSessionMemo(config.ActiveSessionTTL)
+	}
+	if config.EnrichmentContextKey == "" {
+		config.EnrichmentContextKey = DefaultKeycloakConfig.EnrichmentContextKey
+	}
+	if config.EnrichmentTTL == 0 {
+		config.EnrichmentTTL = DefaultKeycloakConfig.EnrichmentTTL
+	}
+	if config.Enricher != nil {
+		config.enrichmentMemo = newSessionMemo(config.EnrichmentTTL)
+	}
+	if config.RetryAfter == 0 {
+		config.RetryAfter = DefaultKeycloakConfig.RetryAfter
+	}
+	if config.SessionTTL == 0 {
+		config.SessionTTL = DefaultKeycloakConfig.SessionTTL
+	}
+	if config.ClaimsChangedHandler != nil {
+		config.sessionClaims = newSessionClaims(config.SessionTTL)
+	}
+	if config.RevocationTTL == 0 {
+		config.RevocationTTL = DefaultKeycloakConfig.RevocationTTL
+	}
+	if config.Revocation {
+		config.revocations = newRevocations()
+	}
+	if config.TrustedTokenHeader != "" {
+		config.trustedUpstream = newTrustedUpstream(config.TrustedTokenHeader, config.TrustedProxies, config.TrustedPeer)
+	}
+	if config.IntrospectionCacheTTL == 0 {
+		config.IntrospectionCacheTTL = DefaultKeycloakConfig.IntrospectionCacheTTL
+	}
+	if config.IntrospectionCacheSize > 0 && config.ValidationMode == IntrospectionValidation {
+		config.introspectionCache = newIntrospectionCache(config.IntrospectionCacheSize)
+	}
+	if config.ValidationCacheSize > 0 && config.ValidationMode == LocalValidation {
+		config.validationCache = newValidationCache(config.ValidationCacheSize)
+	}
 
 	// Initialize
 	parts := strings.Split(config.TokenLookup, ":")
-	extractor := tokenFromHeader(parts[1], config.AuthScheme)
+	if config.DisallowURLTokens && (parts[0] == "query" || parts[0] == "param") {
+		panic("echo: keycloak middleware disallows token lookup from urls: " + config.TokenLookup)
+	}
+	extractor := tokenFromHeader(parts[1], config.AuthScheme, config.DuplicateHeaders)
+	if config.StrictAuthScheme {
+		extractor = tokenFromHeaderStrict(parts[1], config.AuthScheme, config.DuplicateHeaders)
+	}
 	switch parts[0] {
 	case "query":
 		extractor = tokenFromQuery(parts[1])
+		if config.OneTimeQueryTokens {
+			config.usedTokens = newUsedTokens(config.OneTimeTokenMaxAge, config.Leeway, config.TokenCache, func(id string) string {
+				return config.cacheKey(cacheKeyUsedToken, id)
+			})
+		}
 	case "param":
 		extractor = tokenFromParam(parts[1])
 	case "cookie":
 		extractor = tokenFromCookie(parts[1])
+		if len(config.CookieSignatureSecret) > 0 {
+			extractor = tokenFromSignedCookie(parts[1], config.CookieSignatureSuffix, config.CookieSignatureSecret)
+		}
+	case "body":
+		extractor = tokenFromBody(parts[1], config.MaxTokenBodySize)
+	}
+	if config.TokenFunc != nil {
+		extractor = tokenFromFunc(config.TokenFunc, extractor)
+	}
+	v.config = config
+	v.extractor = extractor
+	if config.SweepInterval > 0 {
+		v.sweepEvery(config.SweepInterval)
+		background = true
+	}
+	if background {
+		v.release = append(v.release, registerCloser(v.stopBackground))
+	}
+	v.release = append(v.release, registerCacheFlusher(v.flush))
+	return v
+}
+
+// Middleware returns a Keycloak auth middleware validating tokens with the verifier.
+// See: `Keycloak()`.
+func (v *Verifier) Middleware() echo.MiddlewareFunc {
+	config := &v.config
+	id := nextMiddlewareID()
+	register := func(r *ProtectedRoute) {
+		r.Realm = config.KeycloakRealm
 	}
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			if registry.probe(c, id, register) {
+				return next(c)
+			}
+			var extracted *extractedToken
+			if config.ExtractBeforeSkipper {
+				extracted = v.extract(c)
+				c.Set(extractedTokenContextKey, extracted)
+			}
 			if config.Skipper(c) {
 				return next(c)
 			}
+			registry.protect(c, id, register)
 
 			if config.BeforeFunc != nil {
 				config.BeforeFunc(c)
 			}
 
-			auth, err := extractor(c)
+			route, ok := c.Get(routeConfigContextKey).(*KeycloakRouteConfig)
+			if !ok {
+				route = &defaultRouteConfig
+			}
+			leeway, audiences := config.Leeway, config.RequiredAudience
+			if route.Leeway > 0 {
+				leeway = route.Leeway
+			}
+			if route.RequiredAudience != nil {
+				audiences = route.RequiredAudience
+			}
+
+			if extracted == nil {
+				extracted = v.extract(c)
+			}
+			auth, trusted, err := extracted.token, extracted.trusted, extracted.err
+			if err == ErrTokenMissing && route.OptionalAuth {
+				return next(c)
+			}
 			if err != nil {
+				atomic.AddUint64(&stats.Unauthorized, 1)
+				publishEvent(c, DecisionUnauthorized, "keycloak", nil, err)
+				if err == ErrTokenMissing && config.UnauthorizedOnMissingToken {
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, config.AuthScheme+` realm="`+config.KeycloakRealm+`"`)
+					err = ErrTokenMissingUnauthorized
+				}
 				if config.ErrorHandler != nil {
 					return config.ErrorHandler(err)
 				}
@@ -158,51 +1070,186 @@ func KeycloakWithConfig(config KeycloakConfig) echo.MiddlewareFunc {
 				if config.ErrorHandlerWithContext != nil {
 					return config.ErrorHandlerWithContext(err, c)
 				}
-				return err
+				return respondError(c, err, config.MessageCatalog, config.ErrorBody, config.Negotiate)
 			}
-			token := new(jwt.Token)
-
-			if _, ok := config.Claims.(jwt.MapClaims); ok {
-				token, _, err = config.gocloakClient.DecodeAccessToken(auth, config.KeycloakRealm)
-			} else {
-				t := reflect.ValueOf(config.Claims).Type().Elem()
-				claims := reflect.New(t).Interface().(jwt.Claims)
-				token, err = config.gocloakClient.DecodeAccessTokenCustomClaims(auth, config.KeycloakRealm, claims)
+			token, err := v.validate(c.Request().Context(), auth, trusted, leeway)
+			if err == nil && token.Valid && len(audiences) > 0 {
+				err = verifyAudience(token.Claims, audiences)
+			}
+			if err == nil && token.Valid && config.AudienceResolver != nil {
+				if audiences := config.AudienceResolver(c); len(audiences) > 0 {
+					err = verifyAudience(token.Claims, audiences)
+				}
+			}
+			if err == nil && token.Valid && config.usedTokens != nil {
+				err = config.usedTokens.use(token, config.Now())
+			}
+			if err == nil && token.Valid && config.userInfoMemo != nil {
+				var info *gocloak.UserInfo
+				if info, err = config.userInfo(c.Request().Context(), auth, token); err == nil {
+					c.Set(config.UserInfoContextKey, info)
+				}
+			}
+			if err == nil && token.Valid && config.enrichmentMemo != nil {
+				var enrichment interface{}
+				enrichment, err = config.enrichmentMemo.get(sessionID(token), config.Now(), func() (interface{}, error) {
+					return config.Enricher(c, token)
+				})
+				if err == nil {
+					c.Set(config.EnrichmentContextKey, enrichment)
+				}
 			}
 			if err == nil && token.Valid {
-				c.Set(config.ContextKey, token)
+				atomic.AddUint64(&stats.Authorized, 1)
+				publishTokenEvent(c, DecisionAuthorized, "keycloak", token, nil)
+				if config.ContextMode != StructuredContext {
+					c.Set(config.ContextKey, config.contextValue(token))
+					c.Set(contextKeyContextKey, config.ContextKey)
+				}
+				if config.ContextMode != LegacyContext {
+					c.Set(authContextKey, &AuthContext{
+						Token:    token,
+						Identity: config.identity(token),
+						mode:     config.ContextMode,
+					})
+				}
+				if config.IdentityContextKey != "" {
+					c.Set(config.IdentityContextKey, config.identity(token))
+				}
+				if config.sessionClaims != nil {
+					if old, changed := config.sessionClaims.update(token, config.Now()); changed {
+						claims, _ := mapClaims(token)
+						config.ClaimsChangedHandler(c, old, claims)
+					}
+				}
 				if config.SuccessHandler != nil {
 					config.SuccessHandler(c)
 				}
 				return next(c)
 			}
+			atomic.AddUint64(&stats.Unauthorized, 1)
+			publishTokenEvent(c, DecisionUnauthorized, "keycloak", token, err)
 			if config.ErrorHandler != nil {
 				return config.ErrorHandler(err)
 			}
 			if config.ErrorHandlerWithContext != nil {
 				return config.ErrorHandlerWithContext(err, c)
 			}
-			return &echo.HTTPError{
+			if isUnavailable(err) && config.FailureMode != FailClosed {
+				c.Response().Header().Set(headerRetryAfter, strconv.Itoa(int(config.RetryAfter.Seconds())))
+				err = &echo.HTTPError{
+					Code:     ErrKeycloakUnavailable.Code,
+					Message:  ErrKeycloakUnavailable.Message,
+					Internal: err,
+				}
+				return respondError(c, err, config.MessageCatalog, config.ErrorBody, config.Negotiate)
+			}
+			err = &echo.HTTPError{
 				Code:     http.StatusUnauthorized,
 				Message:  "invalid or expired token",
 				Internal: err,
 			}
+			return respondError(c, err, config.MessageCatalog, config.ErrorBody, config.Negotiate)
+		}
+	}
+}
+
+// introspectionFallback reports whether tokens of IntrospectionValidation are validated
+// locally if the introspection endpoint is unavailable.
+func (config *KeycloakConfig) introspectionFallback() bool {
+	return config.IntrospectionFallback && config.FailureMode == FailWithCachedKeys
+}
+
+// contextValue returns the value of token stored in context.
+func (config *KeycloakConfig) contextValue(token *jwt.Token) interface{} {
+	if config.ContextValue != ClaimsContextValue {
+		return token
+	}
+	if claims, ok := mapClaims(token); ok {
+		return claims
+	}
+	return token.Claims
+}
+
+// tokenFromFunc returns a `tokenExtractor` that returns the token of tokenFunc
+// and falls back to extractor if tokenFunc returns no token.
+func tokenFromFunc(tokenFunc KeycloakTokenFunc, extractor tokenExtractor) tokenExtractor {
+	return func(c echo.Context) (string, error) {
+		token, err := tokenFunc(c)
+		if err != nil || token != "" {
+			return token, err
 		}
+		return extractor(c)
 	}
 }
 
+// headerValue returns the value of the request header, choosing one of multiple
+// headers according to duplicates.
+func headerValue(c echo.Context, header string, duplicates DuplicateHeaderMode) (string, error) {
+	values := c.Request().Header[http.CanonicalHeaderKey(header)]
+	switch {
+	case len(values) == 0:
+		return "", nil
+	case len(values) == 1 || duplicates == FirstDuplicateHeader:
+		return values[0], nil
+	case duplicates == LastDuplicateHeader:
+		return values[len(values)-1], nil
+	}
+	return "", ErrTokenAmbiguous
+}
+
 // tokenFromHeader returns a `tokenExtractor` that extracts token from the request header.
-func tokenFromHeader(header string, authScheme string) tokenExtractor {
+func tokenFromHeader(header string, authScheme string, duplicates DuplicateHeaderMode) tokenExtractor {
 	return func(c echo.Context) (string, error) {
-		auth := c.Request().Header.Get(header)
+		auth, err := headerValue(c, header, duplicates)
+		if err != nil {
+			return "", err
+		}
 		l := len(authScheme)
-		if len(auth) > l+1 && strings.ToLower(auth[:l]) == strings.ToLower(authScheme) {
+		if len(auth) > l+1 && strings.EqualFold(auth[:l], authScheme) {
 			return auth[l+1:], nil
 		}
 		return "", ErrTokenMissing
 	}
 }
 
+// tokenFromHeaderStrict returns a `tokenExtractor` that extracts token from the request header
+// and rejects any deviation from "<authScheme> <token>".
+func tokenFromHeaderStrict(header string, authScheme string, duplicates DuplicateHeaderMode) tokenExtractor {
+	prefix := authScheme + " "
+	return func(c echo.Context) (string, error) {
+		auth, err := headerValue(c, header, duplicates)
+		if err != nil {
+			return "", err
+		}
+		if auth == "" {
+			return "", ErrTokenMissing
+		}
+		if !strings.HasPrefix(auth, prefix) {
+			return "", ErrTokenMalformed
+		}
+		token := auth[len(prefix):]
+		if token == "" || !isTokenString(token) {
+			return "", ErrTokenMalformed
+		}
+		return token, nil
+	}
+}
+
+// isTokenString reports whether s only consists of base64url characters and dots.
+func isTokenString(s string) bool {
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		switch {
+		case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9':
+		case b == '-', b == '_', b == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 // tokenFromQuery returns a `tokenExtractor` that extracts token from the query string.
 func tokenFromQuery(param string) tokenExtractor {
 	return func(c echo.Context) (string, error) {
@@ -226,12 +1273,82 @@ func tokenFromParam(param string) tokenExtractor {
 }
 
 // tokenFromCookie returns a `tokenExtractor` that extracts token from the named cookie.
+// Several cookie names separated by "|" are tried in order.
 func tokenFromCookie(name string) tokenExtractor {
+	names := strings.Split(name, "|")
+	return func(c echo.Context) (string, error) {
+		for _, n := range names {
+			cookie, err := c.Cookie(n)
+			if err == nil && cookie.Value != "" {
+				return cookie.Value, nil
+			}
+		}
+		return "", ErrTokenMissing
+	}
+}
+
+// tokenFromSignedCookie returns a `tokenExtractor` that extracts token from the named cookie
+// and verifies its HMAC-SHA256 signature from the cookie named with suffix.
+// Several cookie names separated by "|" are tried in order.
+func tokenFromSignedCookie(name, suffix string, secret []byte) tokenExtractor {
+	names := strings.Split(name, "|")
+	return func(c echo.Context) (string, error) {
+		for _, n := range names {
+			cookie, err := c.Cookie(n)
+			if err != nil || cookie.Value == "" {
+				continue
+			}
+			signature, err := c.Cookie(n + suffix)
+			if err != nil || !validCookieSignature(cookie.Value, signature.Value, secret) {
+				return "", ErrCookieSignatureInvalid
+			}
+			return cookie.Value, nil
+		}
+		return "", ErrTokenMissing
+	}
+}
+
+// validCookieSignature reports whether signature is the base64url or hex encoded
+// HMAC-SHA256 of value with secret.
+func validCookieSignature(value, signature string, secret []byte) bool {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(value))
+	expected := mac.Sum(nil)
+
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(signature, "="))
+	if err != nil || len(decoded) != len(expected) {
+		if decoded, err = hex.DecodeString(signature); err != nil {
+			return false
+		}
+	}
+	return hmac.Equal(decoded, expected)
+}
+
+// tokenFromBody returns a `tokenExtractor` that extracts token from a field of the JSON request body.
+// The body is buffered up to maxSize and restored so handlers can still read it.
+func tokenFromBody(field string, maxSize int64) tokenExtractor {
 	return func(c echo.Context) (string, error) {
-		cookie, err := c.Cookie(name)
+		req := c.Request()
+		if req.Body == nil {
+			return "", ErrTokenMissing
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(c.Response(), req.Body, maxSize))
+		if err != nil && int64(len(body)) >= maxSize {
+			return "", ErrTokenBodyTooLarge
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
 		if err != nil {
 			return "", ErrTokenMissing
 		}
-		return cookie.Value, nil
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return "", ErrTokenMissing
+		}
+		token, ok := fields[field].(string)
+		if !ok || token == "" {
+			return "", ErrTokenMissing
+		}
+		return token, nil
 	}
 }
@@ -0,0 +1,61 @@
+package keycloak
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Errors
+var (
+	ErrSessionInactive = errors.New("keycloak session is not active")
+)
+
+// verifyActiveSession verifies that the Keycloak session of token is active, memoized
+// per session. Checking the session is cancelled with ctx.
+func (config *KeycloakConfig) verifyActiveSession(ctx context.Context, auth string, token *jwt.Token) error {
+	sid, _ := claimString(token.Claims, "sid")
+	if sid == "" {
+		sid, _ = claimString(token.Claims, "session_state")
+	}
+	if sid == "" {
+		return ErrSessionMissing
+	}
+	active, err := config.activeSessions.get(sid, config.Now(), func() (interface{}, error) {
+		return config.sessionActive(ctx, auth)
+	})
+	if err != nil {
+		return err
+	}
+	if !active.(bool) {
+		return ErrSessionInactive
+	}
+	return nil
+}
+
+// sessionActive reports whether the Keycloak session of auth is active. Keycloak
+// rejects userinfo requests of tokens of terminated sessions.
+func (config *KeycloakConfig) sessionActive(ctx context.Context, auth string) (bool, error) {
+	resp, err := config.gocloakClient.RestyClient().R().
+		SetContext(ctx).
+		SetAuthToken(auth).
+		Get(config.oidcEndpoints().UserInfo)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		return false, &unavailableError{err: err}
+	}
+	switch {
+	case resp.StatusCode() >= http.StatusInternalServerError:
+		return false, &unavailableError{err: fmt.Errorf("could not check session: %s", resp.Status())}
+	case resp.StatusCode() == http.StatusUnauthorized || resp.StatusCode() == http.StatusForbidden:
+		return false, nil
+	case resp.IsError():
+		return false, fmt.Errorf("could not check session: %s", resp.Status())
+	}
+	return true, nil
+}
@@ -0,0 +1,39 @@
+package keycloak
+
+import (
+	"net/http"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+// Errors
+var (
+	ErrActorMissing = echo.NewHTTPError(http.StatusForbidden, "no act claim in token found")
+)
+
+// ActorClaims returns the act (actor) claim of claims of token exchange chains (RFC 8693),
+// the current actor acting on behalf of the subject. Prior actors of the chain are
+// nested in the act claim of the actor.
+func ActorClaims(claims jwt.MapClaims) (jwt.MapClaims, bool) {
+	act, ok := claims["act"].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return jwt.MapClaims(act), true
+}
+
+// Actor returns the sub claim of the actor of the token in context, see
+// `Claim()`. It returns false if the token has no act claim.
+func Actor(c echo.Context) (string, bool) {
+	claims, err := contextClaims(c)
+	if err != nil {
+		return "", false
+	}
+	actor, ok := ActorClaims(claims)
+	if !ok {
+		return "", false
+	}
+	sub, _ := actor["sub"].(string)
+	return sub, sub != ""
+}
@@ -0,0 +1,172 @@
+package keycloak
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+// Errors
+var (
+	ErrTokenRevokedByNotBefore = errors.New("token issued before the not-before policy of the realm")
+	ErrAdminActionInvalid      = echo.NewHTTPError(http.StatusBadRequest, "invalid admin action")
+)
+
+// Admin actions
+const (
+	actionPushNotBefore = "PUSH_NOT_BEFORE"
+	actionLogout        = "LOGOUT"
+)
+
+// maxAdminActionSize is the maximum size of admin requests of Keycloak.
+const maxAdminActionSize = 64 << 10
+
+type (
+	// adminAction contains the fields of all admin actions Keycloak sends to the admin
+	// URL of a client.
+	adminAction struct {
+		ID         string `json:"id"`
+		Expiration int64  `json:"expiration"`
+		Resource   string `json:"resource"`
+		Action     string `json:"action"`
+	}
+
+	// pushNotBeforeAction revokes all tokens issued before NotBefore.
+	pushNotBeforeAction struct {
+		adminAction
+		NotBefore int64 `json:"notBefore"`
+	}
+
+	// logoutAction logs out the Keycloak sessions KeycloakSessionIDs, or all sessions
+	// issued before NotBefore.
+	logoutAction struct {
+		adminAction
+		NotBefore          int64    `json:"notBefore"`
+		KeycloakSessionIDs []string `json:"keycloakSessionIds"`
+	}
+)
+
+// Valid implements jwt.Claims. The action is validated by `Verifier.readAdminAction()`.
+func (a *adminAction) Valid() error {
+	return nil
+}
+
+// KeycloakAdapterAdmin registers the endpoints of the Keycloak adapter admin protocol on
+// g, which Keycloak calls at the admin URL of the client of verifier:
+//
+// - POST /k_push_not_before accepts the not-before policy of the realm, e.g. pushed
+// by "Sessions > Revocation > Push" in the admin console. Afterwards the verifier
+// rejects all tokens issued before it.
+// - POST /k_logout revokes the logged out sessions with `Verifier.RevokeSession()`,
+// if the verifier has Revocation enabled.
+//
+// Admin requests are tokens signed by the realm and are verified with the keys of the
+// verifier. The not-before policy is held in memory, so it must be pushed to every
+// instance of a service.
+func KeycloakAdapterAdmin(g *echo.Group, verifier *Verifier) {
+	g.POST("/k_push_not_before", verifier.pushNotBefore)
+	g.POST("/k_logout", verifier.logout)
+}
+
+// NotBefore returns the not-before policy pushed by Keycloak as unix time, 0 if none.
+func (v *Verifier) NotBefore() int64 {
+	return atomic.LoadInt64(&v.notBefore)
+}
+
+// pushNotBefore handles a pushed not-before policy.
+func (v *Verifier) pushNotBefore(c echo.Context) error {
+	action := &pushNotBeforeAction{}
+	if err := v.readAdminAction(c, action, &action.adminAction, actionPushNotBefore); err != nil {
+		return err
+	}
+	atomic.StoreInt64(&v.notBefore, action.NotBefore)
+	v.config.Logger.Infof("pushed not-before policy of realm %s: %d", v.config.KeycloakRealm, action.NotBefore)
+	return c.NoContent(http.StatusOK)
+}
+
+// logout handles a logout of Keycloak sessions.
+func (v *Verifier) logout(c echo.Context) error {
+	action := &logoutAction{}
+	if err := v.readAdminAction(c, action, &action.adminAction, actionLogout); err != nil {
+		return err
+	}
+	if action.NotBefore > 0 {
+		v.raiseNotBefore(action.NotBefore)
+	}
+	var err error
+	if v.config.revocations != nil {
+		for _, sid := range action.KeycloakSessionIDs {
+			if rerr := v.RevokeSession(sid); rerr != nil {
+				err = rerr
+			}
+		}
+	}
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusServiceUnavailable,
+			Message:  "could not share revocations",
+			Internal: err,
+		}
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// readAdminAction reads and verifies the admin action of the request into claims, whose
+// common fields are action. The action must be of the kind name, not expired and, if
+// ClientID is set, for the client of the verifier.
+func (v *Verifier) readAdminAction(c echo.Context, claims jwt.Claims, action *adminAction, name string) error {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(c.Response(), c.Request().Body, maxAdminActionSize))
+	if err != nil {
+		return ErrAdminActionInvalid
+	}
+	if _, err := v.config.decodeToken(c.Request().Context(), string(body), claims, true, 0); err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusUnauthorized,
+			Message:  "invalid admin token",
+			Internal: err,
+		}
+	}
+	if action.Action != name || action.Expiration < v.config.Now().Unix() {
+		return ErrAdminActionInvalid
+	}
+	if v.config.ClientID != "" && action.Resource != v.config.ClientID {
+		return ErrAdminActionInvalid
+	}
+	return nil
+}
+
+// raiseNotBefore raises the not-before policy to notBefore, e.g. for a logout of all
+// sessions. A pushed policy may also lower it.
+func (v *Verifier) raiseNotBefore(notBefore int64) {
+	for {
+		current := atomic.LoadInt64(&v.notBefore)
+		if notBefore <= current || atomic.CompareAndSwapInt64(&v.notBefore, current, notBefore) {
+			return
+		}
+	}
+}
+
+// verifyNotBefore verifies that the token of claims is issued after the pushed
+// not-before policy.
+func (v *Verifier) verifyNotBefore(claims jwt.Claims) error {
+	notBefore := atomic.LoadInt64(&v.notBefore)
+	if notBefore == 0 {
+		return nil
+	}
+	var iat int64
+	switch value, _ := claimValue(claims, "iat"); n := value.(type) {
+	case float64:
+		iat = int64(n)
+	case json.Number:
+		iat, _ = n.Int64()
+	}
+	if iat < notBefore {
+		return ErrTokenRevokedByNotBefore
+	}
+	return nil
+}
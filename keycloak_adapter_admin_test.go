@@ -0,0 +1,84 @@
+package keycloak
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+func TestKeycloakAdapterAdmin(t *testing.T) {
+	kc := keycloaktest.NewServer("adapter")
+	defer kc.Close()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"action": actionPushNotBefore, "resource": "api", "expiration": time.Now().Add(time.Minute).Unix(), "notBefore": 1,
+	}).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	action := func(name, resource string, expiration time.Time, claims jwt.MapClaims) string {
+		claims["action"] = name
+		claims["resource"] = resource
+		claims["expiration"] = expiration.Unix()
+		return kc.Token(claims)
+	}
+	valid := time.Now().Add(time.Minute)
+
+	tests := map[string]struct {
+		path      string
+		body      string
+		status    int
+		notBefore int64
+		revoked   bool
+	}{
+		"PushNotBefore":     {"/k_push_not_before", action(actionPushNotBefore, "api", valid, jwt.MapClaims{"notBefore": 1000}), http.StatusOK, 1000, false},
+		"PushExpired":       {"/k_push_not_before", action(actionPushNotBefore, "api", time.Now().Add(-time.Minute), jwt.MapClaims{"notBefore": 1000}), http.StatusBadRequest, 0, false},
+		"PushOtherAction":   {"/k_push_not_before", action(actionLogout, "api", valid, jwt.MapClaims{"notBefore": 1000}), http.StatusBadRequest, 0, false},
+		"PushOtherClient":   {"/k_push_not_before", action(actionPushNotBefore, "web", valid, jwt.MapClaims{"notBefore": 1000}), http.StatusBadRequest, 0, false},
+		"PushForeignKey":    {"/k_push_not_before", foreign, http.StatusUnauthorized, 0, false},
+		"PushMalformed":     {"/k_push_not_before", "not-a-token", http.StatusUnauthorized, 0, false},
+		"PushTooLarge":      {"/k_push_not_before", strings.Repeat("a", maxAdminActionSize+1), http.StatusBadRequest, 0, false},
+		"LogoutSessions":    {"/k_logout", action(actionLogout, "api", valid, jwt.MapClaims{"keycloakSessionIds": []string{"session"}}), http.StatusOK, 0, true},
+		"LogoutNotBefore":   {"/k_logout", action(actionLogout, "api", valid, jwt.MapClaims{"notBefore": 2000}), http.StatusOK, 2000, false},
+		"LogoutExpired":     {"/k_logout", action(actionLogout, "api", time.Now().Add(-time.Minute), jwt.MapClaims{"keycloakSessionIds": []string{"session"}}), http.StatusBadRequest, 0, false},
+		"LogoutOtherAction": {"/k_logout", action(actionPushNotBefore, "api", valid, jwt.MapClaims{"keycloakSessionIds": []string{"session"}}), http.StatusBadRequest, 0, false},
+		"LogoutOtherClient": {"/k_logout", action(actionLogout, "web", valid, jwt.MapClaims{"keycloakSessionIds": []string{"session"}}), http.StatusBadRequest, 0, false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := testConfig(kc)
+			config.ClientID = "api"
+			config.Revocation = true
+			v := NewVerifier(config)
+			defer v.Close()
+			e := echo.New()
+			KeycloakAdapterAdmin(e.Group("/admin"), v)
+
+			req := httptest.NewRequest(http.MethodPost, "/admin"+test.path, strings.NewReader(test.body))
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != test.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, test.status, rec.Body)
+			}
+			if n := v.NotBefore(); n != test.notBefore {
+				t.Errorf("NotBefore() = %d, want %d", n, test.notBefore)
+			}
+			_, err := v.ValidateToken(context.Background(), kc.Token(jwt.MapClaims{"sid": "session"}))
+			if revoked := err == ErrTokenRevoked; revoked != test.revoked {
+				t.Errorf("session revoked = %v (%v), want %v", revoked, err, test.revoked)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package keycloak
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// KeycloakAdmin registers operational endpoints on g which are protected by a
+// KeycloakRoles middleware requiring adminRole:
+//
+// - POST /auth/cache/flush empties all caches, see `FlushCaches()`
+// - GET /auth/stats returns the counters of `Stats()`
+// - GET /auth/policy returns the routes and their requirements of `Registry()`
+// - GET /auth/health returns the degradation state, see `HealthHandler()`
+//
+// The Keycloak middleware must be executed before, e.g. by adding it to g.
+func KeycloakAdmin(g *echo.Group, adminRole string) {
+	admin := KeycloakRoles([]string{adminRole})
+
+	g.POST("/auth/cache/flush", func(c echo.Context) error {
+		FlushCaches()
+		return c.NoContent(http.StatusNoContent)
+	}, admin)
+
+	g.GET("/auth/stats", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, Stats())
+	}, admin)
+
+	g.GET("/auth/policy", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, Registry(c.Echo()))
+	}, admin)
+
+	g.GET("/auth/health", HealthHandler, admin)
+}
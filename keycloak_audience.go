@@ -0,0 +1,70 @@
+package keycloak
+
+import (
+	"errors"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+	"github.com/thoas/go-funk"
+)
+
+// Errors
+var (
+	ErrAudienceInvalid = errors.New("token is not issued for a required audience")
+)
+
+// RouteAudiences returns an AudienceResolver returning the audiences of the route
+// path of the request, e.g.:
+//
+//	keycloak.RouteAudiences(map[string][]string{
+//		"/orders/:id": {"orders-api"},
+//		"/invoices":   {"billing-api"},
+//	})
+//
+// Routes missing in audiences are not checked.
+func RouteAudiences(audiences map[string][]string) func(c echo.Context) []string {
+	return func(c echo.Context) []string {
+		return audiences[c.Path()]
+	}
+}
+
+// audienceClaims are claims with an aud claim, e.g. claims embedding jwt.StandardClaims.
+type audienceClaims interface {
+	VerifyAudience(cmp string, req bool) bool
+}
+
+// verifyAudience verifies that the aud claim of claims contains one of audiences. The aud
+// claim of jwt.MapClaims may be a string or an array of strings.
+func verifyAudience(claims jwt.Claims, audiences []string) error {
+	var aud []string
+	switch c := claims.(type) {
+	case *jwt.MapClaims:
+		aud = claimAudience(*c)
+	case jwt.MapClaims:
+		aud = claimAudience(c)
+	case audienceClaims:
+		for _, a := range audiences {
+			if c.VerifyAudience(a, true) {
+				return nil
+			}
+		}
+		return ErrAudienceInvalid
+	}
+	for _, a := range aud {
+		if funk.ContainsString(audiences, a) {
+			return nil
+		}
+	}
+	return ErrAudienceInvalid
+}
+
+// claimAudience returns the audiences of the aud claim.
+func claimAudience(claims jwt.MapClaims) []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		return stringSlice(aud)
+	}
+	return nil
+}
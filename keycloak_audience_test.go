@@ -0,0 +1,51 @@
+package keycloak
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+func TestRequiredAudience(t *testing.T) {
+	kc := keycloaktest.NewServer("audience")
+	defer kc.Close()
+
+	tests := map[string]struct {
+		required []string
+		resolved []string
+		aud      interface{}
+		status   int
+	}{
+		"NotChecked":       {nil, nil, nil, http.StatusNoContent},
+		"String":           {[]string{"api"}, nil, "api", http.StatusNoContent},
+		"Array":            {[]string{"api"}, nil, []interface{}{"account", "api"}, http.StatusNoContent},
+		"OneOfRequired":    {[]string{"api", "admin-api"}, nil, "admin-api", http.StatusNoContent},
+		"OtherAudience":    {[]string{"api"}, nil, "account", http.StatusUnauthorized},
+		"OtherInArray":     {[]string{"api"}, nil, []interface{}{"account", "web"}, http.StatusUnauthorized},
+		"Missing":          {[]string{"api"}, nil, nil, http.StatusUnauthorized},
+		"NonString":        {[]string{"api"}, nil, []interface{}{42}, http.StatusUnauthorized},
+		"CaseSensitive":    {[]string{"api"}, nil, "API", http.StatusUnauthorized},
+		"Resolved":         {nil, []string{"orders-api"}, "orders-api", http.StatusNoContent},
+		"ResolvedNone":     {nil, []string{}, "account", http.StatusNoContent},
+		"ResolvedOther":    {nil, []string{"orders-api"}, "billing-api", http.StatusUnauthorized},
+		"ResolvedRequired": {[]string{"api"}, []string{"orders-api"}, []interface{}{"api", "orders-api"}, http.StatusNoContent},
+		"ResolvedAndOther": {[]string{"api"}, []string{"orders-api"}, "api", http.StatusUnauthorized},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := testConfig(kc)
+			config.RequiredAudience = test.required
+			if test.resolved != nil {
+				config.AudienceResolver = func(echo.Context) []string { return test.resolved }
+			}
+			e := testEcho(KeycloakWithConfig(config))
+			rec := serve(e, "/", kc.Token(jwt.MapClaims{"aud": test.aud}))
+			if rec.Code != test.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, test.status, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package keycloak
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/thoas/go-funk"
+)
+
+// Errors
+var (
+	ErrAuthorizedPartyInvalid = errors.New("token is not issued to an allowed client")
+)
+
+// verifyAuthorizedParty verifies that the azp claim of claims is one of parties.
+func verifyAuthorizedParty(claims jwt.Claims, parties []string) error {
+	if azp, _ := claimString(claims, "azp"); azp == "" || !funk.ContainsString(parties, azp) {
+		return ErrAuthorizedPartyInvalid
+	}
+	return nil
+}
+
+// claimString returns the string claim name of claims and whether claims has it.
+func claimString(claims jwt.Claims, name string) (string, bool) {
+	v, ok := claimValue(claims, name)
+	s, _ := v.(string)
+	return s, ok
+}
+
+// claimValue returns the claim name of claims and whether claims has it. Claims other
+// than jwt.MapClaims are encoded to JSON to read the claim.
+func claimValue(claims jwt.Claims, name string) (interface{}, bool) {
+	var m jwt.MapClaims
+	switch c := claims.(type) {
+	case *jwt.MapClaims:
+		m = *c
+	case jwt.MapClaims:
+		m = c
+	default:
+		data, err := json.Marshal(claims)
+		if err != nil || json.Unmarshal(data, &m) != nil {
+			return nil, false
+		}
+	}
+	v, ok := m[name]
+	return v, ok
+}
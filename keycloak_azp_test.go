@@ -0,0 +1,40 @@
+package keycloak
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestAllowedAuthorizedParties(t *testing.T) {
+	kc := keycloaktest.NewServer("azp")
+	defer kc.Close()
+
+	tests := map[string]struct {
+		parties []string
+		azp     interface{}
+		status  int
+	}{
+		"NotChecked":    {nil, "any-client", http.StatusNoContent},
+		"NotCheckedNil": {nil, nil, http.StatusNoContent},
+		"Allowed":       {[]string{"web", "mobile"}, "mobile", http.StatusNoContent},
+		"OtherClient":   {[]string{"web", "mobile"}, "cli", http.StatusUnauthorized},
+		"Missing":       {[]string{"web"}, nil, http.StatusUnauthorized},
+		"Empty":         {[]string{"web"}, "", http.StatusUnauthorized},
+		"NonString":     {[]string{"web"}, []interface{}{"web"}, http.StatusUnauthorized},
+		"CaseSensitive": {[]string{"web"}, "WEB", http.StatusUnauthorized},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := testConfig(kc)
+			config.AllowedAuthorizedParties = test.parties
+			e := testEcho(KeycloakWithConfig(config))
+			rec := serve(e, "/", kc.Token(jwt.MapClaims{"azp": test.azp}))
+			if rec.Code != test.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, test.status, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package keycloak
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// defaultBasePath is the base path of Keycloak before version 17.
+const defaultBasePath = "/auth"
+
+// detectBasePath returns the base path of the Keycloak server serving the realm, "/"
+// for Keycloak 17 and newer or "/auth" for older versions.
+func (config *KeycloakConfig) detectBasePath() (string, error) {
+	probe := *config
+	for _, basePath := range []string{"/", defaultBasePath} {
+		probe.BasePath = basePath
+		resp, err := config.gocloakClient.RestyClient().R().Get(realmURL(probe))
+		if err != nil {
+			return "", &unavailableError{err: err}
+		}
+		if resp.StatusCode() == http.StatusOK {
+			return basePath, nil
+		}
+	}
+	return "", fmt.Errorf("realm %q not found at %s", config.KeycloakRealm, config.KeycloakURL)
+}
@@ -0,0 +1,180 @@
+package keycloak
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+// benchmarkCaches are the cache configurations the middleware benchmarks run with.
+var benchmarkCaches = []struct {
+	name string
+	size int
+}{
+	{"NoCache", 0},
+	{"ValidationCache", 1000},
+}
+
+// benchmarkRequests sends b.N requests with token to e, which must respond "204 - No Content".
+func benchmarkRequests(b *testing.B, e *echo.Echo, token string) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if rec := serve(e, "/", token); rec.Code != http.StatusNoContent {
+			b.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func BenchmarkKeycloakMiddleware(b *testing.B) {
+	kc := keycloaktest.NewServer("bench")
+	defer kc.Close()
+	token := kc.Token(jwt.MapClaims{"sub": "user"})
+
+	for _, cache := range benchmarkCaches {
+		b.Run(cache.name, func(b *testing.B) {
+			config := testConfig(kc)
+			config.ValidationCacheSize = cache.size
+			v := NewVerifier(config)
+			defer v.Close()
+			benchmarkRequests(b, testEcho(v.Middleware()), token)
+		})
+	}
+}
+
+func BenchmarkRolesCheck(b *testing.B) {
+	kc := keycloaktest.NewServer("bench")
+	defer kc.Close()
+	token := kc.Token(jwt.MapClaims{
+		"sub":          "user",
+		"realm_access": map[string]interface{}{"roles": []string{"user", "reader", "writer"}},
+	})
+
+	for _, cache := range benchmarkCaches {
+		b.Run(cache.name, func(b *testing.B) {
+			config := testConfig(kc)
+			config.ValidationCacheSize = cache.size
+			v := NewVerifier(config)
+			defer v.Close()
+			benchmarkRequests(b, testEcho(v.Middleware(), v.RolesMiddleware("writer")), token)
+		})
+	}
+}
+
+// largeClaims returns the claims of a large token with many realm and client roles.
+func largeClaims() jwt.MapClaims {
+	realmRoles := make([]string, 200)
+	for i := range realmRoles {
+		realmRoles[i] = fmt.Sprintf("realm-role-%d", i)
+	}
+	resourceAccess := make(map[string]interface{}, 20)
+	for i := 0; i < 20; i++ {
+		roles := make([]string, 20)
+		for j := range roles {
+			roles[j] = fmt.Sprintf("client-role-%d", j)
+		}
+		resourceAccess[fmt.Sprintf("client-%d", i)] = map[string]interface{}{"roles": roles}
+	}
+	return jwt.MapClaims{
+		"sub":             "user",
+		"realm_access":    map[string]interface{}{"roles": realmRoles},
+		"resource_access": resourceAccess,
+	}
+}
+
+// realmAccessDecoder decodes only the time claims, typ and the realm roles, like a
+// decoder with pre-compiled claim paths for a service checking realm roles only.
+func realmAccessDecoder(data []byte, v interface{}) error {
+	var claims struct {
+		Exp         float64 `json:"exp"`
+		Iat         float64 `json:"iat"`
+		Typ         string  `json:"typ"`
+		RealmAccess struct {
+			Roles []interface{} `json:"roles"`
+		} `json:"realm_access"`
+	}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return err
+	}
+	m := *v.(*jwt.MapClaims)
+	m["exp"] = claims.Exp
+	m["iat"] = claims.Iat
+	m["typ"] = claims.Typ
+	m["realm_access"] = map[string]interface{}{"roles": claims.RealmAccess.Roles}
+	return nil
+}
+
+// BenchmarkClaimsDecoder measures decoding a large token without verifying its signature.
+func BenchmarkClaimsDecoder(b *testing.B) {
+	kc := keycloaktest.NewServer("bench")
+	defer kc.Close()
+	token := kc.Token(largeClaims())
+
+	for _, decoder := range []struct {
+		name   string
+		decode func(data []byte, v interface{}) error
+	}{
+		{"EncodingJSON", json.Unmarshal},
+		{"RealmAccessOnly", realmAccessDecoder},
+	} {
+		b.Run(decoder.name, func(b *testing.B) {
+			config := testConfig(kc)
+			config.ClaimsDecoder = decoder.decode
+			v := NewVerifier(config)
+			defer v.Close()
+			ctx := context.Background()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := v.config.decodeToken(ctx, token, v.config.NewClaimsFunc(), false, 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkChainedMiddlewares measures a roles middleware alone and chained with client
+// roles, groups and extract roles middlewares sharing the claims extracted per request.
+func BenchmarkChainedMiddlewares(b *testing.B) {
+	kc := keycloaktest.NewServer("bench")
+	defer kc.Close()
+	token := kc.Token(jwt.MapClaims{
+		"sub":             "user",
+		"realm_access":    map[string]interface{}{"roles": []string{"user"}},
+		"resource_access": map[string]interface{}{"api": map[string]interface{}{"roles": []string{"reader"}}},
+		"groups":          []string{"/staff"},
+		"scope":           "openid profile",
+	})
+	clientRoles := DefaultKeycloakRolesConfig
+	clientRoles.KeycloakRoles = []string{"reader"}
+	clientRoles.RoleSource = RealmAndClientRoles
+	clientRoles.ClientID = "api"
+
+	for _, chain := range []struct {
+		name        string
+		middlewares []echo.MiddlewareFunc
+	}{
+		{"Single", nil},
+		{"Chain", []echo.MiddlewareFunc{
+			KeycloakRolesWithConfig(clientRoles),
+			KeycloakGroups([]string{"/staff"}),
+			KeycloakExtractRoles(),
+		}},
+	} {
+		b.Run(chain.name, func(b *testing.B) {
+			config := testConfig(kc)
+			config.ValidationCacheSize = 1000
+			v := NewVerifier(config)
+			defer v.Close()
+			middlewares := append([]echo.MiddlewareFunc{v.Middleware(), v.RolesMiddleware("user")}, chain.middlewares...)
+			benchmarkRequests(b, testEcho(middlewares...), token)
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package keycloak
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/thoas/go-funk"
+)
+
+// KeycloakBinder is an echo.Binder enforcing role requirements declared by struct
+// tags of the bound types, e.g.
+//
+//	type UpdateUser struct {
+//		Name  string `json:"name"`
+//		Admin bool   `json:"admin" auth:"role=admin"`
+//		Quota int    `json:"quota" auth:"role=admin|support"`
+//	}
+//
+// A field with an auth tag may only be set by requests whose token has one of the
+// roles separated by "|". Fields of nested structs are checked as well. Requests
+// setting a field without the role return ErrRolesInvalid ("403 - Forbidden").
+//
+// Whether a request sets a field is decided by the request data, i.e. the keys of
+// JSON bodies, form fields, query and path params, not by the bound value. So zero
+// values like false require the role too, while fields of pre-populated structs not
+// sent by the request do not. All fields are treated as set by other bodies, e.g. XML.
+//
+// Set it as binder of echo, the Keycloak middleware must be executed before Bind:
+//
+//	e.Binder = &keycloak.KeycloakBinder{}
+type KeycloakBinder struct {
+	// Binder binds the request data.
+	// Optional. Default value &echo.DefaultBinder{}.
+	Binder echo.Binder
+
+	// TokenContextKey is the context key which stores the keycloak jwt token
+	// Optional. Default value "user".
+	TokenContextKey string
+
+	// RoleSource defines the claim the roles are taken from.
+	// Optional. Default value RealmRoles.
+	RoleSource RoleSource
+
+	// ClientID defines the client whose roles are used for the ClientRoles and
+	// RealmAndClientRoles role sources.
+	ClientID string
+}
+
+// Bind binds the request data into i and checks the role requirements of the fields
+// set by the request.
+func (b *KeycloakBinder) Bind(i interface{}, c echo.Context) error {
+	binder := b.Binder
+	if binder == nil {
+		binder = &echo.DefaultBinder{}
+	}
+	fields, err := readRequestFields(c)
+	if err != nil {
+		return err
+	}
+	if err := binder.Bind(i, c); err != nil {
+		return err
+	}
+
+	required := fieldRoles(reflect.TypeOf(i), fields, fields.body, nil, nil)
+	if len(required) == 0 {
+		return nil
+	}
+	key := b.TokenContextKey
+	if key == "" {
+		key = DefaultKeycloakRolesConfig.TokenContextKey
+	}
+	claims, err := tokenClaims(c, key)
+	if err != nil {
+		return err
+	}
+	rolesConfig := KeycloakRolesConfig{RoleSource: b.RoleSource, ClientID: b.ClientID}
+	roles, err := rolesConfig.roles(c, claims)
+	if err != nil {
+		return err
+	}
+	for _, oneOf := range required {
+		if len(funk.IntersectString(oneOf, roles)) == 0 {
+			return ErrRolesInvalid
+		}
+	}
+	return nil
+}
+
+type (
+	// requestFields are the names of the data of a request, to find the fields it sets.
+	requestFields struct {
+		// all is set for bodies of unknown fields, setting every field.
+		all bool
+
+		// flat are the names of path params, query params and form fields, which are
+		// bound to fields of nested structs as well.
+		flat map[string]struct{}
+
+		// body are the keys of a JSON body, nil without one.
+		body jsonFields
+	}
+
+	// jsonFields are the keys of JSON objects with the keys of their values. The
+	// objects of arrays are merged.
+	jsonFields map[string]jsonFields
+)
+
+// readRequestFields reads the names of the data of the request, restoring its body for
+// the binder.
+func readRequestFields(c echo.Context) (*requestFields, error) {
+	req := c.Request()
+	fields := &requestFields{flat: make(map[string]struct{})}
+	for _, name := range c.ParamNames() {
+		fields.flat[name] = struct{}{}
+	}
+	for name := range c.QueryParams() {
+		fields.flat[name] = struct{}{}
+	}
+	if req.Body == nil || req.ContentLength == 0 {
+		return fields, nil
+	}
+	ctype := req.Header.Get(echo.HeaderContentType)
+	switch {
+	case strings.HasPrefix(ctype, echo.MIMEApplicationJSON):
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		var data interface{}
+		if err := json.Unmarshal(body, &data); err != nil {
+			fields.all = true
+			return fields, nil
+		}
+		fields.body = collectJSONFields(data)
+	case strings.HasPrefix(ctype, echo.MIMEApplicationForm), strings.HasPrefix(ctype, echo.MIMEMultipartForm):
+		params, err := c.FormParams()
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+		}
+		for name := range params {
+			fields.flat[name] = struct{}{}
+		}
+	default:
+		fields.all = true
+	}
+	return fields, nil
+}
+
+// collectJSONFields returns the keys of the JSON objects of data.
+func collectJSONFields(data interface{}) jsonFields {
+	fields := jsonFields{}
+	switch data := data.(type) {
+	case map[string]interface{}:
+		for key, value := range data {
+			fields[key] = collectJSONFields(value)
+		}
+	case []interface{}:
+		for _, value := range data {
+			fields.merge(collectJSONFields(value))
+		}
+	}
+	return fields
+}
+
+// merge adds the keys of other to f.
+func (f jsonFields) merge(other jsonFields) {
+	for key, value := range other {
+		if fields, ok := f[key]; ok {
+			fields.merge(value)
+		} else {
+			f[key] = value
+		}
+	}
+}
+
+// lookup returns the keys of the value of name, matched case-insensitively like
+// encoding/json does, and whether f has it.
+func (f jsonFields) lookup(name string) (jsonFields, bool) {
+	if fields, ok := f[name]; ok {
+		return fields, true
+	}
+	for key, fields := range f {
+		if strings.EqualFold(key, name) {
+			return fields, true
+		}
+	}
+	return nil, false
+}
+
+// hasFlat reports whether the request has the flat data name.
+func (fields *requestFields) hasFlat(name string) bool {
+	if _, ok := fields.flat[name]; ok {
+		return true
+	}
+	for key := range fields.flat {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldRoles appends the roles of the auth tags of the fields of t set by the request
+// to required. body are the JSON keys of the value of t. Types already on the path are
+// only descended into along JSON bodies, so recursive types terminate.
+func fieldRoles(t reflect.Type, fields *requestFields, body jsonFields, path []reflect.Type, required [][]string) [][]string {
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array:
+			t = t.Elem()
+			continue
+		case reflect.Map:
+			if body != nil {
+				values := jsonFields{}
+				for _, value := range body {
+					values.merge(value)
+				}
+				body = values
+			}
+			t = t.Elem()
+			continue
+		}
+		break
+	}
+	if t.Kind() != reflect.Struct {
+		return required
+	}
+	if body == nil {
+		for _, parent := range path {
+			if parent == t {
+				return required
+			}
+		}
+	}
+	path = append(path, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name := tagName(field, "json")
+		if field.Anonymous && name == "" {
+			// embedded structs are flattened by encoding/json
+			required = fieldRoles(field.Type, fields, body, path, required)
+			continue
+		}
+
+		var value jsonFields
+		set := fields.all
+		if name != "-" && body != nil {
+			if name == "" {
+				name = field.Name
+			}
+			if v, ok := body.lookup(name); ok {
+				value, set = v, true
+			}
+		}
+		for _, tag := range []string{"param", "query", "form"} {
+			name := tagName(field, tag)
+			if name == "" {
+				name = field.Name
+			}
+			if fields.hasFlat(name) {
+				set = true
+			}
+		}
+		if set {
+			for _, option := range strings.Split(field.Tag.Get("auth"), ",") {
+				if strings.HasPrefix(option, "role=") {
+					required = append(required, strings.Split(option[len("role="):], "|"))
+				}
+			}
+		}
+		required = fieldRoles(field.Type, fields, value, path, required)
+	}
+	return required
+}
+
+// tagName returns the name of the tag key of field, without options.
+func tagName(field reflect.StructField, key string) string {
+	name := field.Tag.Get(key)
+	if i := strings.Index(name, ","); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
@@ -0,0 +1,77 @@
+package keycloak
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	binderProfile struct {
+		Verified bool `json:"verified" auth:"role=admin"`
+	}
+
+	binderItem struct {
+		Price int `json:"price" auth:"role=admin"`
+	}
+
+	binderUser struct {
+		Name     string         `json:"name" query:"name" form:"name"`
+		Admin    bool           `json:"admin" query:"admin" form:"admin" auth:"role=admin"`
+		Quota    int            `json:"quota" query:"quota" form:"quota" auth:"role=admin|support"`
+		Profile  *binderProfile `json:"profile"`
+		Items    []binderItem   `json:"items"`
+		Children []binderUser   `json:"children"`
+	}
+)
+
+func TestKeycloakBinder(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		ctype  string
+		body   string
+		user   binderUser
+		roles  []interface{}
+		err    error
+	}{
+		{"unprotected field", http.MethodPost, "/", echo.MIMEApplicationJSON, `{"name":"a"}`, binderUser{}, nil, nil},
+		{"false", http.MethodPost, "/", echo.MIMEApplicationJSON, `{"admin":false}`, binderUser{}, nil, ErrRolesInvalid},
+		{"zero", http.MethodPost, "/", echo.MIMEApplicationJSON, `{"quota":0}`, binderUser{}, nil, ErrRolesInvalid},
+		{"case-insensitive key", http.MethodPost, "/", echo.MIMEApplicationJSON, `{"ADMIN":true}`, binderUser{}, nil, ErrRolesInvalid},
+		{"role", http.MethodPost, "/", echo.MIMEApplicationJSON, `{"admin":true}`, binderUser{}, []interface{}{"admin"}, nil},
+		{"one of roles", http.MethodPost, "/", echo.MIMEApplicationJSON, `{"quota":1}`, binderUser{}, []interface{}{"support"}, nil},
+		{"other role", http.MethodPost, "/", echo.MIMEApplicationJSON, `{"admin":true}`, binderUser{}, []interface{}{"support"}, ErrRolesInvalid},
+		{"pre-populated", http.MethodPost, "/", echo.MIMEApplicationJSON, `{"name":"a"}`, binderUser{Admin: true, Quota: 5}, nil, nil},
+		{"nested", http.MethodPost, "/", echo.MIMEApplicationJSON, `{"profile":{"verified":false}}`, binderUser{}, nil, ErrRolesInvalid},
+		{"nested unprotected", http.MethodPost, "/", echo.MIMEApplicationJSON, `{"profile":{}}`, binderUser{}, nil, nil},
+		{"array", http.MethodPost, "/", echo.MIMEApplicationJSON, `{"items":[{},{"price":0}]}`, binderUser{}, nil, ErrRolesInvalid},
+		{"recursive", http.MethodPost, "/", echo.MIMEApplicationJSON, `{"children":[{"children":[{"admin":false}]}]}`, binderUser{}, nil, ErrRolesInvalid},
+		{"query", http.MethodGet, "/?admin=false", "", "", binderUser{}, nil, ErrRolesInvalid},
+		{"query unprotected", http.MethodGet, "/?name=a", "", "", binderUser{}, nil, nil},
+		{"form", http.MethodPost, "/", echo.MIMEApplicationForm, "quota=0", binderUser{}, nil, ErrRolesInvalid},
+		{"form unprotected", http.MethodPost, "/", echo.MIMEApplicationForm, "name=a", binderUser{}, nil, nil},
+		{"xml", http.MethodPost, "/", echo.MIMEApplicationXML, "<binderUser><Name>a</Name></binderUser>", binderUser{}, nil, ErrRolesInvalid},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+			if test.ctype != "" {
+				req.Header.Set(echo.HeaderContentType, test.ctype)
+			}
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+			c.Set("user", &jwt.Token{Valid: true, Claims: jwt.MapClaims{
+				"realm_access": map[string]interface{}{"roles": test.roles},
+			}})
+			user := test.user
+			if err := (&KeycloakBinder{}).Bind(&user, c); err != test.err {
+				t.Errorf("Bind() = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
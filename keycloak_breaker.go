@@ -0,0 +1,114 @@
+package keycloak
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	// CircuitBreakerConfig defines the config of the circuit breaker of the requests to
+	// Keycloak. While the circuit is open, requests to Keycloak fail immediately instead
+	// of waiting for timeouts of an unreachable Keycloak.
+	CircuitBreakerConfig struct {
+		// Failures is the number of consecutive failed requests opening the circuit.
+		// Requests fail if Keycloak is unreachable or responds with "5xx".
+		// Optional. Default value 5.
+		Failures int
+
+		// OpenTimeout is the duration the circuit stays open. Afterwards one trial
+		// request is sent, which closes the circuit on success.
+		// Optional. Default value 30 seconds.
+		OpenTimeout time.Duration
+	}
+
+	// circuitBreaker is a http.RoundTripper failing fast while the circuit is open.
+	circuitBreaker struct {
+		config      CircuitBreakerConfig
+		next        http.RoundTripper
+		degradation *degradationSource
+
+		mu       sync.Mutex
+		failures int
+		opened   time.Time
+		trial    bool
+	}
+)
+
+// Degraded features
+const (
+	// DegradedCircuit means requests to Keycloak fail fast as the circuit breaker is open.
+	DegradedCircuit = "circuit-open"
+)
+
+var (
+	// DefaultCircuitBreakerConfig is the default circuit breaker config.
+	DefaultCircuitBreakerConfig = CircuitBreakerConfig{
+		Failures:    5,
+		OpenTimeout: 30 * time.Second,
+	}
+)
+
+// Errors
+var (
+	ErrCircuitOpen = errors.New("keycloak circuit breaker is open")
+)
+
+func newCircuitBreaker(config CircuitBreakerConfig, next http.RoundTripper, degradation *degradationSource) *circuitBreaker {
+	if config.Failures == 0 {
+		config.Failures = DefaultCircuitBreakerConfig.Failures
+	}
+	if config.OpenTimeout == 0 {
+		config.OpenTimeout = DefaultCircuitBreakerConfig.OpenTimeout
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &circuitBreaker{config: config, next: next, degradation: degradation}
+}
+
+// RoundTrip sends req unless the circuit is open.
+func (b *circuitBreaker) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !b.allow() {
+		return nil, ErrCircuitOpen
+	}
+	resp, err := b.next.RoundTrip(req)
+	b.record(err == nil && resp.StatusCode < http.StatusInternalServerError)
+	return resp, err
+}
+
+// allow reports whether a request may be sent: if the circuit is closed or as trial
+// request after OpenTimeout.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.config.Failures {
+		return true
+	}
+	if !b.trial && time.Since(b.opened) >= b.config.OpenTimeout {
+		b.trial = true
+		return true
+	}
+	return false
+}
+
+// record records the result of a request, opening the circuit after Failures
+// consecutive failed requests and closing it after a successful one.
+func (b *circuitBreaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if success {
+		if b.failures >= b.config.Failures {
+			b.degradation.recover(DegradedCircuit)
+		}
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.config.Failures {
+		b.opened = time.Now()
+		b.degradation.degrade(DegradedCircuit)
+	}
+}
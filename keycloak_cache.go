@@ -0,0 +1,156 @@
+package keycloak
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// TokenCache is a cache shared by the Keycloak middlewares, e.g. of multiple instances
+// of a service, see `KeycloakConfig.TokenCache`. Implementations must be safe for
+// concurrent use and should treat failures as cache misses.
+type TokenCache interface {
+	// Get returns the value of key or false if it is missing or expired.
+	Get(key string) ([]byte, bool)
+
+	// Set stores value under key for ttl.
+	Set(key string, value []byte, ttl time.Duration)
+
+	// Delete removes key.
+	Delete(key string)
+}
+
+// TokenCacheAdder is implemented by TokenCaches which can store a missing key
+// atomically, e.g. to record one-time tokens shared by multiple instances exactly once.
+type TokenCacheAdder interface {
+	// Add stores value under key for ttl if key is missing or expired and reports
+	// whether it was stored. Failures should be reported as not stored.
+	Add(key string, value []byte, ttl time.Duration) bool
+}
+
+// CheckedTokenCache is implemented by TokenCaches which can fail, e.g. of a remote
+// server, to report failures where they must not be treated as cache misses, e.g. for
+// revocations.
+type CheckedTokenCache interface {
+	// Lookup is Get returning an error instead of a miss on failures.
+	Lookup(key string) ([]byte, bool, error)
+
+	// Store is Set returning an error on failures.
+	Store(key string, value []byte, ttl time.Duration) error
+}
+
+// Cache key kinds
+const (
+	cacheKeyCerts         = "certs"
+	cacheKeyIntrospection = "introspection"
+)
+
+// cacheKey returns the key of a TokenCache entry of kind for the realm of config. Tokens
+// are hashed, so raw tokens are never stored in shared caches.
+func (config *KeycloakConfig) cacheKey(kind, token string) string {
+	key := "echo-keycloak:" + kind + ":" + realmURL(*config)
+	if token == "" {
+		return key
+	}
+	hash := sha256.Sum256([]byte(token))
+	return key + ":" + hex.EncodeToString(hash[:])
+}
+
+type (
+	// memoryCache is an in-memory TokenCache evicting the least recently used entries.
+	memoryCache struct {
+		size int
+
+		mu      sync.Mutex
+		entries *list.List
+		keys    map[string]*list.Element
+	}
+
+	memoryCacheEntry struct {
+		key    string
+		value  []byte
+		expiry time.Time
+	}
+)
+
+// NewMemoryCache returns an in-memory TokenCache holding at most size entries. The
+// least recently used entries are evicted first. It is emptied by `FlushCaches()`
+// while a middleware uses it.
+func NewMemoryCache(size int) TokenCache {
+	if size <= 0 {
+		panic("echo: keycloak memory cache requires size")
+	}
+	return &memoryCache{
+		size:    size,
+		entries: list.New(),
+		keys:    make(map[string]*list.Element, size),
+	}
+}
+
+func (c *memoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.keys[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*memoryCacheEntry)
+	if !time.Now().Before(entry.expiry) {
+		c.entries.Remove(e)
+		delete(c.keys, key)
+		return nil, false
+	}
+	c.entries.MoveToFront(e)
+	return entry.value, true
+}
+
+func (c *memoryCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setLocked(key, value, ttl)
+}
+
+func (c *memoryCache) setLocked(key string, value []byte, ttl time.Duration) {
+	expiry := time.Now().Add(ttl)
+	if e, ok := c.keys[key]; ok {
+		entry := e.Value.(*memoryCacheEntry)
+		entry.value, entry.expiry = value, expiry
+		c.entries.MoveToFront(e)
+		return
+	}
+	c.keys[key] = c.entries.PushFront(&memoryCacheEntry{key: key, value: value, expiry: expiry})
+	for c.entries.Len() > c.size {
+		e := c.entries.Back()
+		c.entries.Remove(e)
+		delete(c.keys, e.Value.(*memoryCacheEntry).key)
+	}
+}
+
+func (c *memoryCache) Add(key string, value []byte, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.keys[key]; ok && time.Now().Before(e.Value.(*memoryCacheEntry).expiry) {
+		return false
+	}
+	c.setLocked(key, value, ttl)
+	return true
+}
+
+func (c *memoryCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.keys[key]; ok {
+		c.entries.Remove(e)
+		delete(c.keys, key)
+	}
+}
+
+// flush removes all entries.
+func (c *memoryCache) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries.Init()
+	c.keys = make(map[string]*list.Element, c.size)
+}
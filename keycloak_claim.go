@@ -0,0 +1,129 @@
+package keycloak
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Claim returns the claim at path of the token of the AuthContext or, in legacy
+// context mode, stored in context under the ContextKey of the Keycloak middleware
+// which authorized the request, "user" by default. The path is a dot-separated list
+// of keys into nested claims, e.g. "resource_access.my-client.roles". It returns
+// false if the token or claim is missing.
+//
+// See `ClaimString()`, `ClaimInt()`, `ClaimFloat()`, `ClaimBool()` and `ClaimStrings()`
+// for claims converted to a type.
+func Claim(c echo.Context, path string) (interface{}, bool) {
+	claims, err := contextClaims(c)
+	if err != nil {
+		return nil, false
+	}
+	var value interface{} = map[string]interface{}(claims)
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// ClaimString returns the claim at path as string, see `Claim()`. Numbers and
+// booleans are formatted.
+func ClaimString(c echo.Context, path string) (string, bool) {
+	value, ok := Claim(c, path)
+	if !ok {
+		return "", false
+	}
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// ClaimFloat returns the claim at path as float64, see `Claim()`. Strings are parsed.
+func ClaimFloat(c echo.Context, path string) (float64, bool) {
+	value, ok := Claim(c, path)
+	if !ok {
+		return 0, false
+	}
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// ClaimInt returns the claim at path as int64, see `Claim()`. Strings are parsed and
+// numbers with fractions are not converted.
+func ClaimInt(c echo.Context, path string) (int64, bool) {
+	value, ok := Claim(c, path)
+	if !ok {
+		return 0, false
+	}
+	switch v := value.(type) {
+	case float64:
+		return int64(v), v == float64(int64(v))
+	case json.Number:
+		i, err := v.Int64()
+		return i, err == nil
+	case string:
+		i, err := strconv.ParseInt(v, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// ClaimBool returns the claim at path as bool, see `Claim()`. Strings are parsed.
+func ClaimBool(c echo.Context, path string) (bool, bool) {
+	value, ok := Claim(c, path)
+	if !ok {
+		return false, false
+	}
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		b, err := strconv.ParseBool(v)
+		return b, err == nil
+	}
+	return false, false
+}
+
+// ClaimStrings returns the claim at path as []string, see `Claim()`. A single string
+// is returned as slice of one string, e.g. for the aud claim, and non-string
+// elements are skipped.
+func ClaimStrings(c echo.Context, path string) ([]string, bool) {
+	value, ok := Claim(c, path)
+	if !ok {
+		return nil, false
+	}
+	switch v := value.(type) {
+	case []interface{}:
+		return stringSlice(v), true
+	case []string:
+		return v, true
+	case string:
+		return []string{v}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,35 @@
+package keycloak
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+func TestClaimContextKey(t *testing.T) {
+	kc := keycloaktest.NewServer("claim")
+	defer kc.Close()
+
+	for _, key := range []string{"user", "token"} {
+		t.Run(key, func(t *testing.T) {
+			config := testConfig(kc)
+			config.ContextKey = key
+			v := NewVerifier(config)
+			defer v.Close()
+
+			e := echo.New()
+			e.GET("/", func(c echo.Context) error {
+				sub, _ := ClaimString(c, "sub")
+				sid, _ := SessionID(c)
+				return c.String(http.StatusOK, sub+" "+sid)
+			}, v.Middleware())
+			rec := serve(e, "/", kc.Token(jwt.MapClaims{"sub": "alice", "sid": "session"}))
+			if body := rec.Body.String(); body != "alice session" {
+				t.Errorf("claims = %q, want %q", body, "alice session")
+			}
+		})
+	}
+}
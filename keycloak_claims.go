@@ -0,0 +1,195 @@
+package keycloak
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+// tokenClaims returns the map claims stored in context under key, either of a valid
+// *jwt.Token or stored directly as claims, falling back to the claims of the
+// AuthContext.
+func tokenClaims(c echo.Context, key string) (jwt.MapClaims, error) {
+	switch v := c.Get(key).(type) {
+	case *jwt.Token:
+		if v != nil && v.Valid {
+			if claims, ok := mapClaims(v); ok {
+				return claims, nil
+			}
+		}
+	case jwt.MapClaims:
+		return v, nil
+	case *jwt.MapClaims:
+		if v != nil {
+			return *v, nil
+		}
+	}
+	if auth, ok := AuthFromContext(c); ok {
+		if claims, ok := mapClaims(auth.Token); ok {
+			return claims, nil
+		}
+	}
+	return nil, ErrClaimsMissing
+}
+
+// mapClaims returns the map claims of token.
+func mapClaims(token *jwt.Token) (jwt.MapClaims, bool) {
+	switch claims := token.Claims.(type) {
+	case *jwt.MapClaims:
+		if claims != nil {
+			return *claims, true
+		}
+	case jwt.MapClaims:
+		return claims, true
+	}
+	return nil, false
+}
+
+// claimsFactory returns a NewClaimsFunc creating claims of the type of claims, for the
+// deprecated `KeycloakConfig.Claims`.
+func claimsFactory(claims jwt.Claims) func() jwt.Claims {
+	if _, ok := claims.(jwt.MapClaims); ok {
+		return func() jwt.Claims {
+			return &jwt.MapClaims{}
+		}
+	}
+	t := reflect.TypeOf(claims)
+	if t.Kind() != reflect.Ptr {
+		panic("echo: keycloak middleware requires claims of a pointer type, see NewClaimsFunc")
+	}
+	return func() jwt.Claims {
+		return reflect.New(t.Elem()).Interface().(jwt.Claims)
+	}
+}
+
+// extractedClaims are the roles, groups and scopes extracted from claims, shared by
+// the chained middlewares of a request so every claim is extracted only once. They
+// are extracted on first use. The extractedClaims of other claims of the request,
+// e.g. of the actor of a token, are linked by next.
+type extractedClaims struct {
+	claims uintptr
+	next   *extractedClaims
+
+	flags         uint8
+	realmRoles    []string
+	realmRolesErr error
+	groups        []string
+	scopes        []string
+	clientID      string
+	clientRoles   []string
+}
+
+// Extracted claims
+const (
+	extractedRealmRolesFlag uint8 = 1 << iota
+	extractedGroupsFlag
+	extractedScopesFlag
+	extractedClientRolesFlag
+)
+
+// extractedClaimsContextKey is the context key storing the extractedClaims of a request.
+const extractedClaimsContextKey = "_keycloak_extracted_claims"
+
+// extracted returns the extractedClaims of claims of the request of c.
+func extracted(c echo.Context, claims jwt.MapClaims) *extractedClaims {
+	id := reflect.ValueOf(claims).Pointer()
+	first, _ := c.Get(extractedClaimsContextKey).(*extractedClaims)
+	for e := first; e != nil; e = e.next {
+		if e.claims == id {
+			return e
+		}
+	}
+	e := &extractedClaims{claims: id, next: first}
+	c.Set(extractedClaimsContextKey, e)
+	return e
+}
+
+// extractedRealmRoles returns the realm roles of claims, which are extracted only once per request.
+func extractedRealmRoles(c echo.Context, claims jwt.MapClaims) ([]string, error) {
+	e := extracted(c, claims)
+	if e.flags&extractedRealmRolesFlag == 0 {
+		e.realmRoles, e.realmRolesErr = realmRoles(claims)
+		e.flags |= extractedRealmRolesFlag
+	}
+	return e.realmRoles, e.realmRolesErr
+}
+
+// extractedClientRoles returns the roles of clientID of claims. The roles of one client
+// are extracted only once per request, which covers the usual single client per service.
+func extractedClientRoles(c echo.Context, claims jwt.MapClaims, clientID string) []string {
+	e := extracted(c, claims)
+	if e.flags&extractedClientRolesFlag == 0 {
+		e.clientID, e.clientRoles = clientID, clientRoles(claims, clientID)
+		e.flags |= extractedClientRolesFlag
+	}
+	if e.clientID != clientID {
+		return clientRoles(claims, clientID)
+	}
+	return e.clientRoles
+}
+
+// extractedGroups returns the groups of claims, which are extracted only once per request.
+func extractedGroups(c echo.Context, claims jwt.MapClaims) []string {
+	e := extracted(c, claims)
+	if e.flags&extractedGroupsFlag == 0 {
+		e.groups = claimGroups(claims)
+		e.flags |= extractedGroupsFlag
+	}
+	return e.groups
+}
+
+// extractedScopes returns the scopes of claims, which are extracted only once per request.
+func extractedScopes(c echo.Context, claims jwt.MapClaims) []string {
+	e := extracted(c, claims)
+	if e.flags&extractedScopesFlag == 0 {
+		e.scopes = claimScopes(claims)
+		e.flags |= extractedScopesFlag
+	}
+	return e.scopes
+}
+
+// realmRoles returns the roles of the realm_access claim.
+func realmRoles(claims jwt.MapClaims) ([]string, error) {
+	realmAccess, ok := claims["realm_access"].(map[string]interface{})
+	if !ok {
+		return nil, ErrRealmAccessMissing
+	}
+	rolesRaw, ok := realmAccess["roles"].([]interface{})
+	if !ok {
+		return nil, ErrRolesMissing
+	}
+	return stringSlice(rolesRaw), nil
+}
+
+// clientRoles returns the roles of clientID of the resource_access claim.
+func clientRoles(claims jwt.MapClaims, clientID string) []string {
+	resourceAccess, _ := claims["resource_access"].(map[string]interface{})
+	client, _ := resourceAccess[clientID].(map[string]interface{})
+	rolesRaw, _ := client["roles"].([]interface{})
+	return stringSlice(rolesRaw)
+}
+
+// claimGroups returns the groups of the groups claim.
+func claimGroups(claims jwt.MapClaims) []string {
+	groupsRaw, _ := claims["groups"].([]interface{})
+	return stringSlice(groupsRaw)
+}
+
+// claimScopes returns the space separated scopes of the scope claim.
+func claimScopes(claims jwt.MapClaims) []string {
+	scope, _ := claims["scope"].(string)
+	return strings.Fields(scope)
+}
+
+// stringSlice returns all strings of values.
+func stringSlice(values []interface{}) []string {
+	strs := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
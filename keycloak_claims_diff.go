@@ -0,0 +1,119 @@
+package keycloak
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// KeycloakClaimsChangedHandler defines a function which is executed when a refreshed
+	// token of a Keycloak session has different claims than the previous token of the
+	// session, e.g. changed roles.
+	KeycloakClaimsChangedHandler func(c echo.Context, old, new jwt.MapClaims)
+
+	// sessionClaims tracks the claims of the latest token per Keycloak session.
+	sessionClaims struct {
+		ttl time.Duration
+
+		mu       sync.Mutex
+		sessions map[string]sessionClaimsEntry
+		swept    time.Time
+	}
+
+	sessionClaimsEntry struct {
+		raw    string
+		claims jwt.MapClaims
+		expiry time.Time
+	}
+)
+
+// volatileClaims change with every token refresh and are ignored when comparing claims.
+var volatileClaims = map[string]struct{}{
+	"exp": {}, "iat": {}, "nbf": {}, "jti": {}, "auth_time": {}, "at_hash": {},
+}
+
+func newSessionClaims(ttl time.Duration) *sessionClaims {
+	return &sessionClaims{
+		ttl:      ttl,
+		sessions: make(map[string]sessionClaimsEntry),
+	}
+}
+
+// update stores the claims of token for its session and returns the claims of the
+// previous token of the session if they differ.
+func (s *sessionClaims) update(token *jwt.Token, now time.Time) (jwt.MapClaims, bool) {
+	sid := sessionID(token)
+	if sid == "" {
+		return nil, false
+	}
+	claims, ok := mapClaims(token)
+	if !ok {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, ok := s.sessions[sid]
+	if ok && previous.raw == token.Raw {
+		return nil, false
+	}
+	if now.Sub(s.swept) >= s.ttl {
+		s.sweepLocked(now)
+	}
+	s.sessions[sid] = sessionClaimsEntry{raw: token.Raw, claims: claims, expiry: now.Add(s.ttl)}
+	if !ok || equalClaims(previous.claims, claims) {
+		return nil, false
+	}
+	return previous.claims, true
+}
+
+// sweep removes the sessions expired at now and returns their number.
+func (s *sessionClaims) sweep(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sweepLocked(now)
+}
+
+func (s *sessionClaims) sweepLocked(now time.Time) int {
+	s.swept = now
+	n := 0
+	for id, entry := range s.sessions {
+		if !now.Before(entry.expiry) {
+			delete(s.sessions, id)
+			n++
+		}
+	}
+	return n
+}
+
+// flush removes all tracked sessions.
+func (s *sessionClaims) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = make(map[string]sessionClaimsEntry)
+}
+
+// equalClaims reports whether a and b are equal, ignoring `volatileClaims`.
+func equalClaims(a, b jwt.MapClaims) bool {
+	for k, v := range a {
+		if _, ok := volatileClaims[k]; ok {
+			continue
+		}
+		if w, ok := b[k]; !ok || !reflect.DeepEqual(v, w) {
+			return false
+		}
+	}
+	for k := range b {
+		if _, ok := volatileClaims[k]; ok {
+			continue
+		}
+		if _, ok := a[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,39 @@
+package keycloak
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+func TestExtractedClaimsAllocations(t *testing.T) {
+	claims := jwt.MapClaims{
+		"realm_access":    map[string]interface{}{"roles": []interface{}{"user", "admin"}},
+		"resource_access": map[string]interface{}{"api": map[string]interface{}{"roles": []interface{}{"reader"}}},
+		"groups":          []interface{}{"/staff"},
+		"scope":           "openid profile",
+	}
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	extract := func() {
+		if roles, err := extractedRealmRoles(c, claims); err != nil || len(roles) != 2 {
+			t.Fatalf("unexpected realm roles %v: %v", roles, err)
+		}
+		if roles := extractedClientRoles(c, claims, "api"); len(roles) != 1 {
+			t.Fatalf("unexpected client roles %v", roles)
+		}
+		if groups := extractedGroups(c, claims); len(groups) != 1 {
+			t.Fatalf("unexpected groups %v", groups)
+		}
+		if scopes := extractedScopes(c, claims); len(scopes) != 2 {
+			t.Fatalf("unexpected scopes %v", scopes)
+		}
+	}
+
+	extract()
+	if allocs := testing.AllocsPerRun(100, extract); allocs != 0 {
+		t.Fatalf("expected no allocations for extracted claims, got %v", allocs)
+	}
+}
@@ -0,0 +1,49 @@
+package keycloak
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// clientAuthentication returns the form fields authenticating the client of config at
+// the token and introspection endpoints: a signed JWT client assertion (private_key_jwt)
+// if ClientAssertionKey is set and the client secret otherwise.
+func clientAuthentication(config KeycloakConfig) (map[string]string, error) {
+	if config.ClientAssertionKey == nil {
+		return map[string]string{
+			"client_id":     config.ClientID,
+			"client_secret": config.ClientSecret,
+		}, nil
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	assertion := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		Issuer:    config.ClientID,
+		Subject:   config.ClientID,
+		Audience:  realmURL(config),
+		Id:        hex.EncodeToString(jti),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+	})
+	if config.ClientAssertionKeyID != "" {
+		assertion.Header["kid"] = config.ClientAssertionKeyID
+	}
+	signed, err := assertion.SignedString(config.ClientAssertionKey)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"client_id":             config.ClientID,
+		"client_assertion_type": clientAssertionType,
+		"client_assertion":      signed,
+	}, nil
+}
@@ -0,0 +1,246 @@
+package keycloak
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/labstack/gommon/log"
+)
+
+type (
+	// ClientRegistrationConfig defines the config for `RegisterClient()`.
+	ClientRegistrationConfig struct {
+		// Keycloak defines the config of the Keycloak middleware of the service.
+		// KeycloakURL, BasePath, KeycloakRealm, ClientID and ClientSecret define the
+		// registered client. Without ClientSecret, Keycloak generates a secret.
+		Keycloak KeycloakConfig
+
+		// RedirectURIs are the valid redirect URIs of the client.
+		// Optional.
+		RedirectURIs []string
+
+		// WebOrigins are the allowed CORS origins of the client.
+		// Optional.
+		WebOrigins []string
+
+		// InitialAccessToken registers the client with dynamic client registration,
+		// e.g. in environments without admin credentials. Existing clients are not
+		// updated.
+		// Required unless AdminUsername is set.
+		InitialAccessToken string
+
+		// AdminUsername and AdminPassword are the credentials of a user permitted to
+		// manage the clients of the realm. They are used to create the client or to
+		// update an existing client and take precedence over InitialAccessToken.
+		// Optional.
+		AdminUsername string
+		AdminPassword string
+
+		// AdminRealm is the realm of the admin user.
+		// Optional. Default value "master".
+		AdminRealm string
+	}
+
+	// RegisteredClient is a client registered by `RegisterClient()`.
+	RegisteredClient struct {
+		// ID is the internal id of the client in Keycloak.
+		ID string
+
+		// ClientID is the client id of the client.
+		ClientID string
+
+		// Secret is the client secret, e.g. generated by Keycloak.
+		Secret string
+
+		// Created reports whether the client was created, as opposed to updated.
+		Created bool
+	}
+
+	// clientRepresentation is the representation of a client of the Keycloak admin
+	// and client registration APIs.
+	clientRepresentation struct {
+		ID           string   `json:"id,omitempty"`
+		ClientID     string   `json:"clientId"`
+		Secret       string   `json:"secret,omitempty"`
+		PublicClient bool     `json:"publicClient"`
+		RedirectURIs []string `json:"redirectUris,omitempty"`
+		WebOrigins   []string `json:"webOrigins,omitempty"`
+	}
+)
+
+var (
+	// DefaultClientRegistrationConfig is the default `RegisterClient()` config.
+	DefaultClientRegistrationConfig = ClientRegistrationConfig{
+		AdminRealm: "master",
+	}
+)
+
+// RegisterClient creates or updates the confidential client of the service in Keycloak
+// with the redirect URIs and web origins of config, e.g. at startup to provision
+// environments from code. Redirect URIs and web origins of existing clients are
+// replaced. Like the middleware, it refuses plain-HTTP Keycloak URLs and unverified
+// TLS certificates unless AllowInsecure is set. The requests are cancelled with ctx.
+func RegisterClient(ctx context.Context, config ClientRegistrationConfig) (*RegisteredClient, error) {
+	if config.Keycloak.KeycloakURL == "" {
+		return nil, fmt.Errorf("keycloak client registration: missing keycloak url")
+	}
+	if config.Keycloak.ClientID == "" {
+		return nil, fmt.Errorf("keycloak client registration: missing client id")
+	}
+	if config.AdminUsername == "" && config.InitialAccessToken == "" {
+		return nil, fmt.Errorf("keycloak client registration: missing admin credentials or initial access token")
+	}
+	if config.AdminRealm == "" {
+		config.AdminRealm = DefaultClientRegistrationConfig.AdminRealm
+	}
+	if config.Keycloak.RequestTimeout == 0 {
+		config.Keycloak.RequestTimeout = DefaultKeycloakConfig.RequestTimeout
+	}
+	if config.Keycloak.Logger == nil {
+		config.Keycloak.Logger = log.New("echo-keycloak")
+	}
+	// admin credentials and initial access tokens must not be sent in plaintext
+	if err := verifyInsecureURL(config.Keycloak.KeycloakURL, config.Keycloak.AllowInsecure, config.Keycloak.Logger); err != nil {
+		return nil, fmt.Errorf("keycloak client registration: %v", err)
+	}
+	if err := verifyInsecureTLS(config.Keycloak.TLSConfig, config.Keycloak.AllowInsecure, config.Keycloak.Logger); err != nil {
+		return nil, fmt.Errorf("keycloak client registration: %v", err)
+	}
+	if config.Keycloak.ProxyURL != "" {
+		if _, err := url.Parse(config.Keycloak.ProxyURL); err != nil {
+			return nil, fmt.Errorf("keycloak client registration: invalid proxy url: %v", err)
+		}
+	}
+	client := config.Keycloak.newGocloakClient().RestyClient()
+	representation := clientRepresentation{
+		ClientID:     config.Keycloak.ClientID,
+		Secret:       config.Keycloak.ClientSecret,
+		RedirectURIs: config.RedirectURIs,
+		WebOrigins:   config.WebOrigins,
+	}
+
+	var registered *RegisteredClient
+	var err error
+	if config.AdminUsername != "" {
+		registered, err = config.registerWithAdmin(ctx, client, representation)
+	} else {
+		registered, err = config.registerDynamically(ctx, client, representation)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("keycloak client registration: client %q: %v", config.Keycloak.ClientID, err)
+	}
+	return registered, nil
+}
+
+// registerDynamically creates the client with the client registration API.
+func (config *ClientRegistrationConfig) registerDynamically(ctx context.Context, client *resty.Client, representation clientRepresentation) (*RegisteredClient, error) {
+	var created clientRepresentation
+	resp, err := client.R().
+		SetContext(ctx).
+		SetAuthToken(config.InitialAccessToken).
+		SetBody(representation).
+		SetResult(&created).
+		Post(realmURL(config.Keycloak, "clients-registrations", "default"))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusConflict {
+		return nil, fmt.Errorf("client exists, updating requires admin credentials")
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status())
+	}
+	return &RegisteredClient{
+		ID:       created.ID,
+		ClientID: representation.ClientID,
+		Secret:   created.Secret,
+		Created:  true,
+	}, nil
+}
+
+// registerWithAdmin creates or updates the client with the admin API.
+func (config *ClientRegistrationConfig) registerWithAdmin(ctx context.Context, client *resty.Client, representation clientRepresentation) (*RegisteredClient, error) {
+	adminRealm := config.Keycloak
+	adminRealm.KeycloakRealm = config.AdminRealm
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	resp, err := client.R().
+		SetContext(ctx).
+		SetFormData(map[string]string{
+			"grant_type": "password",
+			"client_id":  "admin-cli",
+			"username":   config.AdminUsername,
+			"password":   config.AdminPassword,
+		}).
+		SetResult(&token).
+		Post(realmURL(adminRealm, "protocol", "openid-connect", "token"))
+	if err = responseError(resp, err); err != nil {
+		return nil, fmt.Errorf("admin login: %v", err)
+	}
+
+	var existing []clientRepresentation
+	resp, err = client.R().
+		SetContext(ctx).
+		SetAuthToken(token.AccessToken).
+		SetQueryParam("clientId", representation.ClientID).
+		SetResult(&existing).
+		Get(adminURL(config.Keycloak, "clients"))
+	if err = responseError(resp, err); err != nil {
+		return nil, err
+	}
+
+	registered := &RegisteredClient{ClientID: representation.ClientID}
+	if len(existing) == 0 {
+		resp, err = client.R().
+			SetContext(ctx).
+			SetAuthToken(token.AccessToken).
+			SetBody(representation).
+			Post(adminURL(config.Keycloak, "clients"))
+		if err = responseError(resp, err); err != nil {
+			return nil, err
+		}
+		registered.ID = path.Base(resp.Header().Get("Location"))
+		registered.Created = true
+	} else {
+		registered.ID = existing[0].ID
+		representation.ID = existing[0].ID
+		resp, err = client.R().
+			SetContext(ctx).
+			SetAuthToken(token.AccessToken).
+			SetBody(representation).
+			Put(adminURL(config.Keycloak, "clients", registered.ID))
+		if err = responseError(resp, err); err != nil {
+			return nil, err
+		}
+	}
+
+	var secret struct {
+		Value string `json:"value"`
+	}
+	resp, err = client.R().
+		SetContext(ctx).
+		SetAuthToken(token.AccessToken).
+		SetResult(&secret).
+		Get(adminURL(config.Keycloak, "clients", registered.ID, "client-secret"))
+	if err = responseError(resp, err); err != nil {
+		return nil, err
+	}
+	registered.Secret = secret.Value
+	return registered, nil
+}
+
+// responseError returns err or an error of the status of resp if it is not successful.
+func responseError(resp *resty.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	if resp.IsError() {
+		return fmt.Errorf("unexpected status %s", resp.Status())
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package keycloak
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/labstack/gommon/log"
+)
+
+func TestRegisterClientInsecure(t *testing.T) {
+	var requests uint64
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddUint64(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	logger := log.New("echo-keycloak")
+	logger.SetOutput(ioutil.Discard)
+
+	tests := map[string]KeycloakConfig{
+		"PlainHTTP":   {KeycloakURL: "http://sso.example.com", KeycloakRealm: "demo", ClientID: "app"},
+		"InsecureTLS": {KeycloakURL: server.URL, KeycloakRealm: "demo", ClientID: "app", TLSConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	for name, keycloak := range tests {
+		t.Run(name, func(t *testing.T) {
+			for _, config := range []ClientRegistrationConfig{
+				{Keycloak: keycloak, AdminUsername: "admin", AdminPassword: "secret"},
+				{Keycloak: keycloak, InitialAccessToken: "token"},
+			} {
+				config.Keycloak.Logger = logger
+				_, err := RegisterClient(context.Background(), config)
+				if err == nil || !strings.Contains(err.Error(), "AllowInsecure") {
+					t.Errorf("RegisterClient() = %v, want insecure error", err)
+				}
+			}
+		})
+	}
+	if requests != 0 {
+		t.Errorf("sent %d requests with credentials", requests)
+	}
+}
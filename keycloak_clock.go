@@ -0,0 +1,33 @@
+package keycloak
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/labstack/echo/v4"
+)
+
+// clockSkewResolution is the resolution of the clock skew measured with the Date header.
+const clockSkewResolution = time.Second
+
+// watchClockSkew warns about responses of client whose Date header differs from the
+// local time by more than maxSkew, as clock skew causes tokens to be rejected.
+func watchClockSkew(client *resty.Client, maxSkew time.Duration, logger echo.Logger) {
+	client.OnAfterResponse(func(_ *resty.Client, resp *resty.Response) error {
+		checkClockSkew(resp.RawResponse, maxSkew, logger)
+		return nil
+	})
+}
+
+// checkClockSkew counts and logs a warning if the clock skew of resp exceeds maxSkew.
+func checkClockSkew(resp *http.Response, maxSkew time.Duration, logger echo.Logger) {
+	if resp == nil {
+		return
+	}
+	if skew := clockSkew(resp, time.Now()); skew > maxSkew || skew < -maxSkew {
+		atomic.AddUint64(&stats.ClockSkewWarnings, 1)
+		logger.Warnf("clock skew to keycloak of %v exceeds %v, tokens may be rejected", skew, maxSkew)
+	}
+}
@@ -0,0 +1,33 @@
+package keycloak
+
+import (
+	"testing"
+	"time"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+)
+
+func TestMaxClockSkewFromLeeway(t *testing.T) {
+	kc := keycloaktest.NewServer("clock")
+	defer kc.Close()
+
+	tests := map[string]struct {
+		leeway, maxSkew, want time.Duration
+	}{
+		"NoLeeway": {0, 0, time.Second},
+		"Leeway":   {time.Minute, 0, time.Minute + time.Second},
+		"Explicit": {time.Minute, 10 * time.Second, 10 * time.Second},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := testConfig(kc)
+			config.Leeway = test.leeway
+			config.MaxClockSkew = test.maxSkew
+			v := NewVerifier(config)
+			defer v.Close()
+			if v.config.MaxClockSkew != test.want {
+				t.Errorf("MaxClockSkew = %v, want %v", v.config.MaxClockSkew, test.want)
+			}
+		})
+	}
+}
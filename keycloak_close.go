@@ -0,0 +1,38 @@
+package keycloak
+
+import "sync"
+
+var (
+	closersMu sync.Mutex
+	closers   = make(map[uint64]func())
+	closerIDs uint64
+)
+
+// Close stops the background goroutines of all middlewares of this package, e.g.
+// the key refresh of `KeycloakConfig.KeyRefreshInterval`. It should be called on
+// shutdown of the server. Middlewares keep working after Close, but without
+// background work.
+func Close() {
+	closersMu.Lock()
+	stops := closers
+	closers = make(map[uint64]func())
+	closersMu.Unlock()
+	for _, stop := range stops {
+		stop()
+	}
+}
+
+// registerCloser registers a function stopping a background goroutine for `Close()`
+// and returns a function removing it again.
+func registerCloser(stop func()) (unregister func()) {
+	closersMu.Lock()
+	defer closersMu.Unlock()
+	closerIDs++
+	id := closerIDs
+	closers[id] = stop
+	return func() {
+		closersMu.Lock()
+		defer closersMu.Unlock()
+		delete(closers, id)
+	}
+}
@@ -0,0 +1,153 @@
+package keycloak
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// AuthContext is the structured context value of a request authorized by a
+	// Keycloak middleware with StructuredContext or CompatibleContext mode, see
+	// `AuthFromContext()`.
+	AuthContext struct {
+		// Token is the validated token. It is read-only with ValidationCacheSize.
+		Token *jwt.Token
+
+		// Identity is the normalized identity of the token.
+		Identity Identity
+
+		// Roles are the roles of the token checked by the latest roles middleware,
+		// nil before.
+		Roles []string
+
+		mode ContextMode
+	}
+
+	// ContextMode defines the context values stored by the Keycloak middleware.
+	ContextMode int
+)
+
+// Context modes
+const (
+	// LegacyContext stores the token under ContextKey and the roles under
+	// RolesContextKey of roles middlewares.
+	LegacyContext ContextMode = iota
+
+	// StructuredContext stores the AuthContext only.
+	StructuredContext
+
+	// CompatibleContext stores both the legacy context values and the AuthContext,
+	// e.g. during a migration to StructuredContext.
+	CompatibleContext
+)
+
+const (
+	authContextKey = "_keycloak_auth"
+
+	// contextKeyContextKey stores the ContextKey of the middleware authorizing the
+	// request, so the accessors of this package find the legacy context value.
+	contextKeyContextKey = "_keycloak_context_key"
+)
+
+// LegacyContextHook is executed when a legacy context value is read with
+// `LegacyToken()`, `LegacyClaims()` or `LegacyRoles()`, or by an accessor of this
+// package, e.g. `Claim()`, if the AuthContext has no map claims, with the key read. It
+// fires only for requests authorized by a middleware with StructuredContext or
+// CompatibleContext mode, as legacy values are expected in LegacyContext mode. Reading
+// legacy values with these accessors instead of `echo.Context.Get()`, it may be used
+// to find code depending on them before switching to StructuredContext, e.g. by
+// logging a warning in CompatibleContext mode.
+// Optional.
+var LegacyContextHook func(c echo.Context, key string)
+
+// AuthFromContext returns the AuthContext of the request. It returns false in
+// LegacyContext mode or if the request is not authorized.
+func AuthFromContext(c echo.Context) (*AuthContext, bool) {
+	auth, ok := c.Get(authContextKey).(*AuthContext)
+	return auth, ok && auth.Token != nil
+}
+
+// contextClaims returns the claims of the token of the request for the accessors of
+// this package, preferring the AuthContext over the legacy context value, see
+// `legacyContextKey()`.
+func contextClaims(c echo.Context) (jwt.MapClaims, error) {
+	auth, structured := AuthFromContext(c)
+	if structured {
+		if claims, ok := mapClaims(auth.Token); ok {
+			return claims, nil
+		}
+	}
+	key := legacyContextKey(c)
+	claims, err := tokenClaims(c, key)
+	if err == nil {
+		legacyRead(c, key)
+	}
+	return claims, err
+}
+
+// legacyContextKey returns the ContextKey of the Keycloak middleware which authorized
+// the request, or the default context key "user" for tokens stored by other code.
+func legacyContextKey(c echo.Context) string {
+	if key, ok := c.Get(contextKeyContextKey).(string); ok {
+		return key
+	}
+	return DefaultKeycloakConfig.ContextKey
+}
+
+// LegacyToken returns the token stored in context under key in LegacyContext and
+// CompatibleContext mode, see `LegacyContextHook`. It returns false if no token is
+// stored, e.g. in StructuredContext mode or with ClaimsContextValue.
+func LegacyToken(c echo.Context, key string) (*jwt.Token, bool) {
+	legacyRead(c, key)
+	token, ok := c.Get(key).(*jwt.Token)
+	return token, ok && token != nil
+}
+
+// LegacyClaims returns the claims of the token or the claims stored in context under
+// key in LegacyContext and CompatibleContext mode, see `LegacyContextHook`. It returns
+// false if no map claims are stored, e.g. in StructuredContext mode.
+func LegacyClaims(c echo.Context, key string) (jwt.MapClaims, bool) {
+	legacyRead(c, key)
+	switch v := c.Get(key).(type) {
+	case *jwt.Token:
+		if v != nil {
+			return mapClaims(v)
+		}
+	case jwt.MapClaims:
+		return v, true
+	case *jwt.MapClaims:
+		if v != nil {
+			return *v, true
+		}
+	}
+	return nil, false
+}
+
+// LegacyRoles returns the roles stored in context under key by a roles middleware in
+// LegacyContext and CompatibleContext mode, see `LegacyContextHook`. It returns false
+// if no roles are stored, e.g. in StructuredContext mode.
+func LegacyRoles(c echo.Context, key string) ([]string, bool) {
+	legacyRead(c, key)
+	roles, ok := c.Get(key).([]string)
+	return roles, ok
+}
+
+// legacyRead executes LegacyContextHook for a read of the legacy context value at key
+// of a request authorized in StructuredContext or CompatibleContext mode.
+func legacyRead(c echo.Context, key string) {
+	if _, structured := AuthFromContext(c); structured && LegacyContextHook != nil {
+		LegacyContextHook(c, key)
+	}
+}
+
+// setRoles stores the checked roles into the AuthContext and, unless in
+// StructuredContext mode, into context under key.
+func setRoles(c echo.Context, key string, roles []string) {
+	auth, ok := AuthFromContext(c)
+	if ok {
+		auth.Roles = roles
+	}
+	if !ok || auth.mode != StructuredContext {
+		c.Set(key, roles)
+	}
+}
@@ -0,0 +1,86 @@
+package keycloak
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+func TestLegacyContextHook(t *testing.T) {
+	claims := jwt.MapClaims{"sub": "user"}
+	tests := map[string]struct {
+		auth  *AuthContext
+		fired bool
+	}{
+		"Legacy":              {nil, false},
+		"Structured":          {&AuthContext{Token: &jwt.Token{Claims: claims, Valid: true}, mode: StructuredContext}, false},
+		"CompatibleMapClaims": {&AuthContext{Token: &jwt.Token{Claims: claims, Valid: true}, mode: CompatibleContext}, false},
+		"CompatibleOtherClaims": {
+			&AuthContext{Token: &jwt.Token{Claims: &jwt.StandardClaims{Subject: "user"}, Valid: true}, mode: CompatibleContext},
+			true,
+		},
+	}
+	defer func() { LegacyContextHook = nil }()
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fired := false
+			LegacyContextHook = func(c echo.Context, key string) { fired = true }
+
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+			c.Set(DefaultKeycloakConfig.ContextKey, &jwt.Token{Claims: claims, Valid: true})
+			if test.auth != nil {
+				c.Set(authContextKey, test.auth)
+			}
+			if _, err := contextClaims(c); err != nil {
+				t.Fatalf("contextClaims() = %v", err)
+			}
+			if fired != test.fired {
+				t.Errorf("LegacyContextHook fired = %v, want %v", fired, test.fired)
+			}
+		})
+	}
+}
+
+func TestLegacyAccessors(t *testing.T) {
+	token := &jwt.Token{Claims: jwt.MapClaims{"sub": "user"}, Valid: true}
+	tests := map[string]struct {
+		mode  ContextMode
+		fired bool
+	}{
+		"Legacy":     {LegacyContext, false},
+		"Compatible": {CompatibleContext, true},
+		"Structured": {StructuredContext, true},
+	}
+	defer func() { LegacyContextHook = nil }()
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var keys []string
+			LegacyContextHook = func(c echo.Context, key string) { keys = append(keys, key) }
+
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+			if test.mode != StructuredContext {
+				c.Set("user", token)
+				c.Set("roles", []string{"admin"})
+			}
+			if test.mode != LegacyContext {
+				c.Set(authContextKey, &AuthContext{Token: token, mode: test.mode})
+			}
+			got, ok := LegacyToken(c, "user")
+			if want := test.mode != StructuredContext; ok != want || ok && got != token {
+				t.Errorf("LegacyToken() = %v, %v, want %v", got, ok, want)
+			}
+			if _, ok := LegacyClaims(c, "user"); ok != (test.mode != StructuredContext) {
+				t.Errorf("LegacyClaims() = %v", ok)
+			}
+			if _, ok := LegacyRoles(c, "roles"); ok != (test.mode != StructuredContext) {
+				t.Errorf("LegacyRoles() = %v", ok)
+			}
+			if fired := len(keys) == 3; fired != test.fired || test.fired && keys[2] != "roles" {
+				t.Errorf("LegacyContextHook keys = %v, want fired %v", keys, test.fired)
+			}
+		})
+	}
+}
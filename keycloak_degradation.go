@@ -0,0 +1,136 @@
+package keycloak
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// DegradationReport describes the degraded features of the middlewares, e.g. validating
+	// with stale keys while Keycloak is unreachable.
+	DegradationReport struct {
+		// Degraded reports whether any feature is degraded.
+		Degraded bool `json:"degraded"`
+
+		// Since is the time the earliest degradation began.
+		Since time.Time `json:"since,omitempty"`
+
+		// Features maps the degraded features to the time their degradation began at
+		// any source.
+		Features map[string]time.Time `json:"features,omitempty"`
+
+		// Sources maps the degraded sources, e.g. the JWKS URL of a key set, to their
+		// degraded features.
+		Sources map[string]map[string]time.Time `json:"sources,omitempty"`
+	}
+
+	// degradations tracks the degraded features by source.
+	degradations struct {
+		mu      sync.Mutex
+		sources map[*degradationSource]struct{}
+	}
+
+	// degradationSource tracks the degraded features of a source, e.g. a key set or a
+	// circuit breaker of a verifier. Its methods are no-ops on nil.
+	degradationSource struct {
+		name     string
+		features map[string]time.Time
+	}
+)
+
+// Degraded features
+const (
+	// DegradedKeys means tokens are validated with stale keys as the keys could not be fetched.
+	DegradedKeys = "stale-keys"
+)
+
+var degradation = &degradations{sources: make(map[*degradationSource]struct{})}
+
+// Degradation returns the current degradation state of the middlewares, combining the
+// sources of all verifiers which are not closed.
+func Degradation() DegradationReport {
+	degradation.mu.Lock()
+	defer degradation.mu.Unlock()
+	var report DegradationReport
+	for source := range degradation.sources {
+		for feature, since := range source.features {
+			if !report.Degraded {
+				report.Degraded = true
+				report.Features = make(map[string]time.Time)
+				report.Sources = make(map[string]map[string]time.Time)
+			}
+			earliest(report.Features, feature, since)
+			if _, ok := report.Sources[source.name]; !ok {
+				report.Sources[source.name] = make(map[string]time.Time)
+			}
+			earliest(report.Sources[source.name], feature, since)
+			if report.Since.IsZero() || since.Before(report.Since) {
+				report.Since = since
+			}
+		}
+	}
+	return report
+}
+
+// HealthHandler responds with the degradation state of the middlewares and status "ok"
+// or "degraded". It always responds with "200 - OK", as degraded middlewares still serve
+// requests.
+func HealthHandler(c echo.Context) error {
+	report := Degradation()
+	status := "ok"
+	if report.Degraded {
+		status = "degraded"
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status":      status,
+		"degradation": report,
+	})
+}
+
+// source returns a new source with name, e.g. the JWKS URL of a key set.
+func (d *degradations) source(name string) *degradationSource {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	source := &degradationSource{name: name, features: make(map[string]time.Time)}
+	d.sources[source] = struct{}{}
+	return source
+}
+
+// remove removes source, e.g. of a closed verifier, and thereby its degraded features.
+func (d *degradations) remove(source *degradationSource) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.sources, source)
+}
+
+// degrade marks feature of s as degraded if it is not yet.
+func (s *degradationSource) degrade(feature string) {
+	if s == nil {
+		return
+	}
+	degradation.mu.Lock()
+	defer degradation.mu.Unlock()
+	if _, ok := s.features[feature]; !ok {
+		s.features[feature] = time.Now()
+	}
+}
+
+// recover marks feature of s as healthy.
+func (s *degradationSource) recover(feature string) {
+	if s == nil {
+		return
+	}
+	degradation.mu.Lock()
+	defer degradation.mu.Unlock()
+	delete(s.features, feature)
+}
+
+// earliest sets features[feature] to since unless it is earlier.
+func earliest(features map[string]time.Time, feature string, since time.Time) {
+	if current, ok := features[feature]; !ok || since.Before(current) {
+		features[feature] = since
+	}
+}
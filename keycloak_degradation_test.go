@@ -0,0 +1,32 @@
+package keycloak
+
+import (
+	"testing"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+)
+
+func TestDegradationBySource(t *testing.T) {
+	kc := keycloaktest.NewServer("degradation")
+	defer kc.Close()
+
+	a := NewVerifier(testConfig(kc))
+	b := NewVerifier(testConfig(kc))
+	defer b.Close()
+
+	// A verifier recovering does not hide the degradation of another one.
+	a.config.keySet.degradation.degrade(DegradedKeys)
+	b.config.keySet.degradation.degrade(DegradedKeys)
+	b.config.keySet.degradation.recover(DegradedKeys)
+	report := Degradation()
+	jwks := a.config.oidcEndpoints().JWKS
+	if !report.Degraded || len(report.Features) != 1 || len(report.Sources[jwks]) != 1 {
+		t.Fatalf("degradation = %+v, want %s of %s", report, DegradedKeys, jwks)
+	}
+
+	// A closed verifier does not leave the state degraded.
+	a.Close()
+	if report := Degradation(); report.Degraded {
+		t.Fatalf("degradation = %+v after close, want not degraded", report)
+	}
+}
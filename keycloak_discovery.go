@@ -0,0 +1,86 @@
+package keycloak
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OIDCEndpoints are the endpoints of a realm, resolved with OIDC discovery if
+// `KeycloakConfig.IssuerURL` is set.
+type OIDCEndpoints struct {
+	// Issuer is the issuer URL of the realm.
+	Issuer string `json:"issuer"`
+
+	// Authorization is the authorization endpoint.
+	Authorization string `json:"authorization_endpoint"`
+
+	// Token is the token endpoint.
+	Token string `json:"token_endpoint"`
+
+	// Introspection is the token introspection endpoint.
+	Introspection string `json:"introspection_endpoint"`
+
+	// UserInfo is the userinfo endpoint.
+	UserInfo string `json:"userinfo_endpoint"`
+
+	// EndSession is the end-session (logout) endpoint.
+	EndSession string `json:"end_session_endpoint"`
+
+	// JWKS is the URL of the JSON web key set.
+	JWKS string `json:"jwks_uri"`
+}
+
+// Endpoints returns the endpoints of the realm of the verifier, e.g. to redirect to
+// the end-session endpoint on logout.
+func (v *Verifier) Endpoints() OIDCEndpoints {
+	return v.config.oidcEndpoints()
+}
+
+// oidcEndpoints returns the discovered endpoints of the realm or the endpoints of
+// Keycloak below the realm URL.
+func (config *KeycloakConfig) oidcEndpoints() OIDCEndpoints {
+	if config.endpoints != nil {
+		return *config.endpoints
+	}
+	return OIDCEndpoints{
+		Issuer:        realmURL(*config),
+		Authorization: realmURL(*config, "protocol", "openid-connect", "auth"),
+		Token:         realmURL(*config, "protocol", "openid-connect", "token"),
+		Introspection: realmURL(*config, "protocol", "openid-connect", "token", "introspect"),
+		UserInfo:      realmURL(*config, "protocol", "openid-connect", "userinfo"),
+		EndSession:    realmURL(*config, "protocol", "openid-connect", "logout"),
+		JWKS:          realmURL(*config, "protocol", "openid-connect", "certs"),
+	}
+}
+
+// discover resolves the endpoints of the realm from the OIDC discovery document of
+// IssuerURL. Endpoints missing in the document are taken from `oidcEndpoints()`.
+func (config *KeycloakConfig) discover() (*OIDCEndpoints, error) {
+	endpoints := config.oidcEndpoints()
+	resp, err := config.gocloakClient.RestyClient().R().
+		SetResult(&endpoints).
+		Get(strings.TrimRight(config.IssuerURL, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, &unavailableError{err: err}
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("could not get openid configuration: %s", resp.Status())
+	}
+	return &endpoints, nil
+}
+
+// splitIssuerURL splits the issuer URL of a Keycloak realm into the Keycloak URL, the
+// base path and the realm, e.g. "https://sso.example.com/auth/realms/demo" into
+// "https://sso.example.com", "/auth" and "demo".
+func splitIssuerURL(issuer string) (keycloakURL, basePath, realm string) {
+	issuer = strings.TrimRight(issuer, "/")
+	i := strings.LastIndex(issuer, "/realms/")
+	if i < 0 {
+		return issuer, "/", ""
+	}
+	base, realm := issuer[:i], issuer[i+len("/realms/"):]
+	if strings.HasSuffix(base, defaultBasePath) {
+		return strings.TrimSuffix(base, defaultBasePath), defaultBasePath, realm
+	}
+	return base, "/", realm
+}
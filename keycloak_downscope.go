@@ -0,0 +1,39 @@
+package keycloak
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Nerzal/gocloak/v5"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+	"github.com/thoas/go-funk"
+)
+
+// Errors
+var (
+	ErrScopesNotGranted = echo.NewHTTPError(http.StatusForbidden, "scopes not granted")
+)
+
+// DownscopeToken requests a token with a subset of the scopes of token from Keycloak,
+// e.g. to hand it to less-trusted places like a widget storing it in the browser
+// while the full token is kept server-side. The token is requested via token
+// exchange as the client of the verifier, which must be permitted to exchange tokens,
+// with the client and token endpoint of the verifier. The request is cancelled with
+// ctx, e.g. the context of the request.
+//
+// It returns ErrScopesNotGranted if scopes is empty or contains scopes not granted
+// to token.
+func (v *Verifier) DownscopeToken(ctx context.Context, token *jwt.Token, scopes ...string) (*gocloak.JWT, error) {
+	claims, ok := mapClaims(token)
+	if !ok || len(scopes) == 0 {
+		return nil, ErrScopesNotGranted
+	}
+	granted := claimScopes(claims)
+	for _, scope := range scopes {
+		if !funk.ContainsString(granted, scope) {
+			return nil, ErrScopesNotGranted
+		}
+	}
+	return v.config.exchangeToken(ctx, token.Raw, v.config.ClientID, scopes)
+}
@@ -0,0 +1,51 @@
+package keycloak
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/thoas/go-funk"
+)
+
+type (
+	// KeycloakEnvironment defines the Keycloak server and realm of an environment.
+	KeycloakEnvironment struct {
+		// KeycloakURL defines the URL of the Keycloak server.
+		KeycloakURL string
+
+		// KeycloakRealm defines the realm of the Keycloak server.
+		KeycloakRealm string
+	}
+
+	// KeycloakEnvironments maps environment names, e.g. "dev", "stage" and "prod",
+	// to their Keycloak server and realm.
+	KeycloakEnvironments map[string]KeycloakEnvironment
+)
+
+var (
+	// ProductionEnvironments are the environment names whose Keycloak URL must use TLS.
+	ProductionEnvironments = []string{"prod", "production"}
+)
+
+// Config returns config with the Keycloak URL and realm of the environment name.
+// It fails for unknown environments and for production environments (see
+// `ProductionEnvironments`) whose Keycloak URL does not use https.
+func (envs KeycloakEnvironments) Config(name string, config KeycloakConfig) (KeycloakConfig, error) {
+	env, ok := envs[name]
+	if !ok {
+		return config, fmt.Errorf("keycloak: unknown environment %q", name)
+	}
+	if funk.ContainsString(ProductionEnvironments, strings.ToLower(name)) {
+		u, err := url.Parse(env.KeycloakURL)
+		if err != nil {
+			return config, fmt.Errorf("keycloak: invalid url of environment %q: %v", name, err)
+		}
+		if u.Scheme != "https" {
+			return config, fmt.Errorf("keycloak: environment %q requires an https url, got %q", name, env.KeycloakURL)
+		}
+	}
+	config.KeycloakURL = env.KeycloakURL
+	config.KeycloakRealm = env.KeycloakRealm
+	return config, nil
+}
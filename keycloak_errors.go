@@ -0,0 +1,160 @@
+package keycloak
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// NegotiateConfig defines how auth errors are rendered depending on the Accept header
+	// of the request. JSON is rendered for "application/json", HTML for "text/html" and
+	// plain text otherwise.
+	NegotiateConfig struct {
+		// HTMLTemplate renders errors for browsers. It is executed with the *echo.HTTPError.
+		// Optional. Default is a minimal HTML page containing the error message.
+		HTMLTemplate *template.Template
+
+		// LoginURL redirects browsers to the given login page for "401 - Unauthorized"
+		// errors instead of rendering HTML.
+		// Optional.
+		LoginURL string
+	}
+
+	// KeycloakErrorBodyFunc returns the response body for an auth error, e.g. a
+	// JSON envelope or a localized message. Strings are rendered as
+	// {"message": "..."}, any other value is rendered as is.
+	KeycloakErrorBodyFunc func(echo.Context, *echo.HTTPError) interface{}
+
+	// KeycloakMessageCatalog translates an error message into the given lower-case
+	// language tag (e.g. "de" or "de-at"). It returns false if no translation exists.
+	KeycloakMessageCatalog func(language, message string) (string, bool)
+)
+
+const headerAcceptLanguage = "Accept-Language"
+
+// respondError returns err with its message translated by catalog and the body of
+// errorBody and renders it with negotiate if set.
+func respondError(c echo.Context, err error, catalog KeycloakMessageCatalog, errorBody KeycloakErrorBodyFunc, negotiate *NegotiateConfig) error {
+	if he, ok := err.(*echo.HTTPError); ok && (catalog != nil || errorBody != nil) {
+		he = &echo.HTTPError{
+			Code:     he.Code,
+			Message:  he.Message,
+			Internal: he.Internal,
+		}
+		if message, ok := he.Message.(string); ok && catalog != nil {
+			he.Message = translate(c, catalog, message)
+		}
+		if errorBody != nil {
+			he.Message = errorBody(c, he)
+		}
+		err = he
+	}
+	if negotiate != nil {
+		return negotiate.render(c, err)
+	}
+	return err
+}
+
+// render writes err to the response according to the Accept header of the request.
+// Errors which are no *echo.HTTPError are returned unchanged.
+func (n *NegotiateConfig) render(c echo.Context, err error) error {
+	he, ok := err.(*echo.HTTPError)
+	if !ok {
+		return err
+	}
+	message, isString := he.Message.(string)
+	if !isString {
+		message = fmt.Sprint(he.Message)
+	}
+
+	accept := c.Request().Header.Get(echo.HeaderAccept)
+	switch {
+	case strings.Contains(accept, echo.MIMEApplicationJSON):
+		if !isString {
+			return c.JSON(he.Code, he.Message)
+		}
+		return c.JSON(he.Code, map[string]interface{}{"message": message})
+	case strings.Contains(accept, echo.MIMETextHTML):
+		if n.LoginURL != "" && he.Code == http.StatusUnauthorized {
+			return c.Redirect(http.StatusFound, n.LoginURL)
+		}
+		if n.HTMLTemplate != nil {
+			c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+			c.Response().WriteHeader(he.Code)
+			return n.HTMLTemplate.Execute(c.Response(), he)
+		}
+		return c.HTML(he.Code, "<!DOCTYPE html><html><body><p>"+html.EscapeString(message)+"</p></body></html>")
+	default:
+		return c.String(he.Code, message)
+	}
+}
+
+// MapMessageCatalog returns a `KeycloakMessageCatalog` looking up translations in
+// messages, which maps a language tag (e.g. "de") to original messages and their
+// translations.
+func MapMessageCatalog(messages map[string]map[string]string) KeycloakMessageCatalog {
+	return func(language, message string) (string, bool) {
+		translated, ok := messages[language][message]
+		return translated, ok
+	}
+}
+
+// translate returns message translated into the most preferred language of the
+// Accept-Language header known by catalog.
+func translate(c echo.Context, catalog KeycloakMessageCatalog, message string) string {
+	for _, language := range acceptLanguages(c.Request().Header.Get(headerAcceptLanguage)) {
+		if translated, ok := catalog(language, message); ok {
+			return translated
+		}
+		if i := strings.Index(language, "-"); i > 0 {
+			if translated, ok := catalog(language[:i], message); ok {
+				return translated
+			}
+		}
+	}
+	return message
+}
+
+// acceptLanguages returns the language tags of an Accept-Language header ordered by
+// quality. Languages with quality 0 are not acceptable and dropped.
+func acceptLanguages(header string) []string {
+	type language struct {
+		tag     string
+		quality float64
+	}
+	var languages []language
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		l := language{tag: strings.ToLower(strings.TrimSpace(fields[0])), quality: 1}
+		if l.tag == "" || l.tag == "*" {
+			continue
+		}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(strings.ToLower(param), "q=") {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(param[2:]), 64); err == nil {
+					l.quality = q
+				}
+			}
+		}
+		if l.quality <= 0 {
+			continue
+		}
+		languages = append(languages, l)
+	}
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+	tags := make([]string, len(languages))
+	for i, l := range languages {
+		tags[i] = l.tag
+	}
+	return tags
+}
@@ -0,0 +1,22 @@
+package keycloak
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAcceptLanguages(t *testing.T) {
+	tests := map[string][]string{
+		"de":                          {"de"},
+		"en;q=0.5, de":                {"de", "en"},
+		"de, en;q=0":                  {"de"},
+		"de;Q=0, en":                  {"en"},
+		"fr;q=0.0, *;q=0.1, en;q=0.2": {"en"},
+		"":                            {},
+	}
+	for header, want := range tests {
+		if got := acceptLanguages(header); !reflect.DeepEqual(got, want) {
+			t.Errorf("acceptLanguages(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package keycloak
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// AuthEvent is an auth decision of a middleware of this package.
+	AuthEvent struct {
+		// Time is the time of the decision.
+		Time time.Time `json:"time"`
+
+		// Decision is the decision, one of DecisionAuthorized, DecisionUnauthorized
+		// and DecisionForbidden.
+		Decision string `json:"decision"`
+
+		// Middleware is the middleware deciding, e.g. "keycloak" or "roles".
+		Middleware string `json:"middleware"`
+
+		// Method is the method of the request.
+		Method string `json:"method"`
+
+		// Path is the route path of the request, e.g. "/users/:id".
+		Path string `json:"path"`
+
+		// RealIP is the client IP of the request.
+		RealIP string `json:"realIp"`
+
+		// Subject is the sub claim of the token, empty if there is no valid token.
+		Subject string `json:"subject,omitempty"`
+
+		// Err is the reason of denied requests.
+		Err error `json:"-"`
+	}
+
+	// eventSubscribers are the subscribers of auth events.
+	eventSubscribers struct {
+		mu    sync.RWMutex
+		count int32
+		subs  map[chan AuthEvent]struct{}
+	}
+)
+
+// Decisions
+const (
+	DecisionAuthorized   = "authorized"
+	DecisionUnauthorized = "unauthorized"
+	DecisionForbidden    = "forbidden"
+)
+
+var events = &eventSubscribers{subs: make(map[chan AuthEvent]struct{})}
+
+// SubscribeEvents returns a channel receiving the auth decisions of all middlewares of
+// this package, e.g. for anomaly detection, and a function to unsubscribe which closes
+// the channel.
+//
+// Events are buffered up to buffer events. Requests never wait for slow subscribers:
+// events not fitting in the buffer are dropped and counted in `Stats()`.
+func SubscribeEvents(buffer int) (<-chan AuthEvent, func()) {
+	ch := make(chan AuthEvent, buffer)
+	events.mu.Lock()
+	events.subs[ch] = struct{}{}
+	atomic.StoreInt32(&events.count, int32(len(events.subs)))
+	events.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			events.mu.Lock()
+			defer events.mu.Unlock()
+			delete(events.subs, ch)
+			atomic.StoreInt32(&events.count, int32(len(events.subs)))
+			close(ch)
+		})
+	}
+}
+
+// publishEvent sends the decision of middleware for the request of c to all subscribers.
+// claims are the claims of the token if any.
+func publishEvent(c echo.Context, decision, middleware string, claims jwt.MapClaims, err error) {
+	if atomic.LoadInt32(&events.count) == 0 {
+		return
+	}
+	event := AuthEvent{
+		Time:       time.Now(),
+		Decision:   decision,
+		Middleware: middleware,
+		Method:     c.Request().Method,
+		Path:       c.Path(),
+		RealIP:     c.RealIP(),
+		Err:        err,
+	}
+	event.Subject, _ = claims["sub"].(string)
+
+	events.mu.RLock()
+	defer events.mu.RUnlock()
+	for ch := range events.subs {
+		select {
+		case ch <- event:
+		default:
+			atomic.AddUint64(&stats.EventsDropped, 1)
+		}
+	}
+}
+
+// publishTokenEvent is `publishEvent()` with the claims of token.
+func publishTokenEvent(c echo.Context, decision, middleware string, token *jwt.Token, err error) {
+	var claims jwt.MapClaims
+	if token != nil && token.Valid {
+		claims, _ = mapClaims(token)
+	}
+	publishEvent(c, decision, middleware, claims, err)
+}
@@ -0,0 +1,52 @@
+package keycloak
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v5"
+)
+
+const tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// exchangeToken exchanges subjectToken for an access token of audience with the given
+// scopes via OAuth 2.0 token exchange (RFC 8693), authenticated as the client of config,
+// see `clientAuthentication()`, with the client and token endpoint of the middleware.
+// The request is cancelled with ctx.
+func (config *KeycloakConfig) exchangeToken(ctx context.Context, subjectToken, audience string, scopes []string) (*gocloak.JWT, error) {
+	form := map[string]string{
+		"grant_type":           tokenExchangeGrantType,
+		"subject_token":        subjectToken,
+		"subject_token_type":   "urn:ietf:params:oauth:token-type:access_token",
+		"requested_token_type": "urn:ietf:params:oauth:token-type:access_token",
+	}
+	if audience != "" {
+		form["audience"] = audience
+	}
+	if len(scopes) > 0 {
+		form["scope"] = strings.Join(scopes, " ")
+	}
+
+	auth, err := clientAuthentication(*config)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range auth {
+		form[k] = v
+	}
+
+	var token gocloak.JWT
+	resp, err := config.gocloakClient.RestyClient().R().
+		SetContext(ctx).
+		SetFormData(form).
+		SetResult(&token).
+		Post(config.oidcEndpoints().Token)
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("could not exchange token: %s", resp.Status())
+	}
+	return &token, nil
+}
@@ -0,0 +1,79 @@
+package keycloak
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+func TestDownscopeToken(t *testing.T) {
+	kc := keycloaktest.NewServer("exchange")
+	defer kc.Close()
+	transport := &countingTransport{}
+	config := testConfig(kc)
+	config.ClientID = "app"
+	config.HTTPClient = &http.Client{Transport: transport}
+	v := NewVerifier(config)
+	defer v.Close()
+
+	token, err := v.ValidateToken(context.Background(), kc.Token(jwt.MapClaims{"scope": "openid profile email"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		scopes []string
+		err    error
+	}{
+		{[]string{"profile"}, nil},
+		{[]string{"profile", "email"}, nil},
+		{[]string{"admin"}, ErrScopesNotGranted},
+		{nil, ErrScopesNotGranted},
+	}
+	for _, test := range tests {
+		requests := transport.requests
+		downscoped, err := v.DownscopeToken(context.Background(), token, test.scopes...)
+		if err != test.err {
+			t.Errorf("DownscopeToken(%v) = %v, want %v", test.scopes, err, test.err)
+			continue
+		}
+		if err == nil && (downscoped.AccessToken == "" || transport.requests != requests+1) {
+			t.Errorf("DownscopeToken(%v) did not exchange the token with HTTPClient", test.scopes)
+		}
+	}
+}
+
+func TestKeycloakGateway(t *testing.T) {
+	kc := keycloaktest.NewServer("exchange")
+	defer kc.Close()
+	var forwarded string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get(echo.HeaderAuthorization)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+	targetURL, _ := url.Parse(target.URL)
+
+	transport := &countingTransport{}
+	config := testConfig(kc)
+	config.ClientID = "gateway"
+	config.HTTPClient = &http.Client{Transport: transport}
+	e := echo.New()
+	e.GET("/", KeycloakGateway(KeycloakGatewayConfig{Keycloak: config, Target: targetURL, Audience: "service"}))
+
+	token := kc.Token(nil)
+	if rec := serve(e, "/", token); rec.Code != http.StatusNoContent {
+		t.Fatalf("status %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body)
+	}
+	if forwarded == "" || forwarded == "Bearer "+token {
+		t.Errorf("forwarded authorization %q, want exchanged token", forwarded)
+	}
+	if transport.requests == 0 {
+		t.Error("token exchange did not use HTTPClient")
+	}
+}
@@ -0,0 +1,106 @@
+package keycloak
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type (
+	// KeycloakExtractRolesConfig defines the config for the KeycloakExtractRoles middleware.
+	KeycloakExtractRolesConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper middleware.Skipper
+
+		// SkipDefaultRoutes additionally skips OPTIONS requests and the paths in
+		// `DefaultSkipPaths` (health, metrics and favicon routes).
+		// Optional. Default value false.
+		SkipDefaultRoutes bool
+
+		// BeforeFunc defines a function which is executed just before the middleware.
+		BeforeFunc middleware.BeforeFunc
+
+		// TokenContextKey is the context key which stores the keycloak jwt token
+		// Optional. Default value "user".
+		TokenContextKey string
+
+		// RolesContextKey is the context key which stores the realm roles as []string
+		// Optional. Default value "roles".
+		RolesContextKey string
+
+		// GroupsContextKey is the context key which stores the groups as []string
+		// Optional. Default value "groups".
+		GroupsContextKey string
+
+		// ScopesContextKey is the context key which stores the scopes as []string
+		// Optional. Default value "scopes".
+		ScopesContextKey string
+	}
+)
+
+var (
+	// DefaultKeycloakExtractRolesConfig is the default KeycloakExtractRoles middleware config.
+	DefaultKeycloakExtractRolesConfig = KeycloakExtractRolesConfig{
+		Skipper:          middleware.DefaultSkipper,
+		TokenContextKey:  "user",
+		RolesContextKey:  "roles",
+		GroupsContextKey: "groups",
+		ScopesContextKey: "scopes",
+	}
+)
+
+// KeycloakExtractRoles returns a middleware which stores the roles, groups and scopes
+// of the token in context without enforcing any of them.
+//
+// Requests without token in context are passed to the next handler unchanged.
+func KeycloakExtractRoles() echo.MiddlewareFunc {
+	return KeycloakExtractRolesWithConfig(DefaultKeycloakExtractRolesConfig)
+}
+
+// KeycloakExtractRolesWithConfig returns a KeycloakExtractRoles middleware with config.
+// See: `KeycloakExtractRoles()`.
+func KeycloakExtractRolesWithConfig(config KeycloakExtractRolesConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultKeycloakExtractRolesConfig.Skipper
+	}
+	if config.SkipDefaultRoutes {
+		config.Skipper = withDefaultRoutes(config.Skipper)
+	}
+	if config.TokenContextKey == "" {
+		config.TokenContextKey = DefaultKeycloakExtractRolesConfig.TokenContextKey
+	}
+	if config.RolesContextKey == "" {
+		config.RolesContextKey = DefaultKeycloakExtractRolesConfig.RolesContextKey
+	}
+	if config.GroupsContextKey == "" {
+		config.GroupsContextKey = DefaultKeycloakExtractRolesConfig.GroupsContextKey
+	}
+	if config.ScopesContextKey == "" {
+		config.ScopesContextKey = DefaultKeycloakExtractRolesConfig.ScopesContextKey
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			if config.BeforeFunc != nil {
+				config.BeforeFunc(c)
+			}
+
+			claims, err := tokenClaims(c, config.TokenContextKey)
+			if err != nil {
+				return next(c)
+			}
+			roles, _ := extractedRealmRoles(c, claims)
+			if roles == nil {
+				roles = []string{}
+			}
+			setRoles(c, config.RolesContextKey, roles)
+			c.Set(config.GroupsContextKey, extractedGroups(c, claims))
+			c.Set(config.ScopesContextKey, extractedScopes(c, claims))
+			return next(c)
+		}
+	}
+}
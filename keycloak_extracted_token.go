@@ -0,0 +1,44 @@
+package keycloak
+
+import "github.com/labstack/echo/v4"
+
+// extractedToken is the result of the token extraction of a request.
+type extractedToken struct {
+	token   string
+	trusted bool
+	err     error
+}
+
+const extractedTokenContextKey = "_keycloak_extracted_token"
+
+// ExtractedToken returns the raw token of the request extracted by a Keycloak
+// middleware with ExtractBeforeSkipper, e.g. in its Skipper:
+//
+//	config.ExtractBeforeSkipper = true
+//	config.Skipper = func(c echo.Context) bool {
+//		_, err := keycloak.ExtractedToken(c)
+//		return err == keycloak.ErrTokenMissing
+//	}
+//
+// It returns the extraction error, e.g. ErrTokenMissing, and ErrTokenMissing if no
+// token was extracted.
+func ExtractedToken(c echo.Context) (string, error) {
+	extracted, ok := c.Get(extractedTokenContextKey).(*extractedToken)
+	if !ok {
+		return "", ErrTokenMissing
+	}
+	return extracted.token, extracted.err
+}
+
+// extract extracts the token of the request of c, preferring the token of a trusted
+// upstream.
+func (v *Verifier) extract(c echo.Context) *extractedToken {
+	extracted := &extractedToken{}
+	if v.config.trustedUpstream != nil {
+		extracted.token, extracted.trusted = v.config.trustedUpstream.token(c)
+	}
+	if !extracted.trusted {
+		extracted.token, extracted.err = v.extractor(c)
+	}
+	return extracted
+}
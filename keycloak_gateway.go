@@ -0,0 +1,82 @@
+package keycloak
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// KeycloakGatewayConfig defines the config for the KeycloakGateway handler.
+	KeycloakGatewayConfig struct {
+		// Keycloak defines the config of the Keycloak middleware validating inbound
+		// tokens. Its ClientID and ClientSecret are used for the token exchange and
+		// the client must be permitted to exchange tokens for Audience, with the client,
+		// TLSConfig and endpoints of the middleware. Its ContextValue is always
+		// TokenContextValue.
+		Keycloak KeycloakConfig
+
+		// Target is the URL of the service requests are forwarded to.
+		Target *url.URL
+
+		// Audience is the client id of the target service the exchanged token is issued for.
+		Audience string
+
+		// Scopes are the scopes requested for the exchanged token.
+		// Optional.
+		Scopes []string
+
+		// Transport is used to forward requests.
+		// Optional. Default value http.DefaultTransport.
+		Transport http.RoundTripper
+	}
+)
+
+// Errors
+var (
+	ErrTokenExchangeFailed = echo.NewHTTPError(http.StatusBadGateway, "token exchange failed")
+)
+
+// KeycloakGateway returns a handler acting as auth gateway in front of a service: it
+// validates the inbound token with the Keycloak middleware, exchanges it for a token of
+// Audience and forwards the request with the exchanged token to Target.
+func KeycloakGateway(config KeycloakGatewayConfig) echo.HandlerFunc {
+	if config.Target == nil {
+		panic("echo: keycloak gateway requires target url")
+	}
+	if config.Keycloak.ClientID == "" {
+		panic("echo: keycloak gateway requires client id")
+	}
+	config.Keycloak.ContextValue = TokenContextValue
+	if config.Keycloak.ContextMode == StructuredContext {
+		config.Keycloak.ContextMode = CompatibleContext
+	}
+	verifier := NewVerifier(config.Keycloak)
+	proxy := httputil.NewSingleHostReverseProxy(config.Target)
+	if config.Transport != nil {
+		proxy.Transport = config.Transport
+	}
+
+	forward := func(c echo.Context) error {
+		token, ok := c.Get(verifier.config.ContextKey).(*jwt.Token)
+		if !ok {
+			return ErrClaimsMissing
+		}
+		exchanged, err := verifier.config.exchangeToken(c.Request().Context(), token.Raw, config.Audience, config.Scopes)
+		if err != nil {
+			return &echo.HTTPError{
+				Code:     ErrTokenExchangeFailed.Code,
+				Message:  ErrTokenExchangeFailed.Message,
+				Internal: err,
+			}
+		}
+		req := c.Request()
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+exchanged.AccessToken)
+		proxy.ServeHTTP(c.Response(), req)
+		return nil
+	}
+	return verifier.Middleware()(forward)
+}
@@ -0,0 +1,196 @@
+package keycloak
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type (
+	// KeycloakGroupsConfig defines the config for the KeycloakGroups middleware.
+	KeycloakGroupsConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper middleware.Skipper
+
+		// SkipDefaultRoutes additionally skips OPTIONS requests and the paths in
+		// `DefaultSkipPaths` (health, metrics and favicon routes).
+		// Optional. Default value false.
+		SkipDefaultRoutes bool
+
+		// BeforeFunc defines a function which is executed just before the middleware.
+		BeforeFunc middleware.BeforeFunc
+
+		// SuccessHandler defines a function which is executed for a valid token.
+		SuccessHandler KeycloakSuccessHandler
+
+		// ErrorHandler defines a function which is executed for an invalid token.
+		// It may be used to define a custom KeycloakGroups error.
+		ErrorHandler KeycloakErrorHandler
+
+		// ErrorHandlerWithContext is almost identical to ErrorHandler, but it's passed the current context.
+		ErrorHandlerWithContext KeycloakErrorHandlerWithContext
+
+		// MessageCatalog translates error messages into the language requested by
+		// the Accept-Language header. It is only used if neither ErrorHandler nor
+		// ErrorHandlerWithContext is set.
+		// Optional. See `MapMessageCatalog()`.
+		MessageCatalog KeycloakMessageCatalog
+
+		// ErrorBody defines the response body of errors, e.g. a brand-consistent
+		// JSON envelope. It is only used if neither ErrorHandler nor
+		// ErrorHandlerWithContext is set.
+		// Optional. Default body is {"message": "<error message>"}.
+		ErrorBody KeycloakErrorBodyFunc
+
+		// Negotiate renders errors as JSON, HTML or plain text depending on the
+		// Accept header of the request. It is only used if neither ErrorHandler
+		// nor ErrorHandlerWithContext is set.
+		// Optional.
+		Negotiate *NegotiateConfig
+
+		// KeycloakGroups defines the group paths having access, e.g. "/org/team".
+		KeycloakGroups []string
+
+		// GroupMatch defines how the groups of the token are matched with KeycloakGroups.
+		// Optional. Default value ExactGroupMatch.
+		GroupMatch GroupMatch
+
+		// TokenContextKey is the context key which stores the keycloak jwt token
+		// Optional. Default value "user".
+		TokenContextKey string
+
+		// GroupsContextKey is the context key which stores the groups as []string
+		// Optional. Default value "groups".
+		GroupsContextKey string
+	}
+
+	// GroupMatch defines how groups are matched.
+	GroupMatch int
+)
+
+// Group matches
+const (
+	// ExactGroupMatch requires the token to have one of the groups.
+	ExactGroupMatch GroupMatch = iota
+
+	// SubtreeGroupMatch requires the token to have one of the groups or one of their
+	// subgroups, e.g. "/org" matches "/org" and "/org/team/dev" but not "/organization".
+	SubtreeGroupMatch
+)
+
+// Errors
+var (
+	ErrGroupsInvalid = echo.NewHTTPError(http.StatusForbidden, "invalid groups")
+)
+
+var (
+	// DefaultKeycloakGroupsConfig is the default KeycloakGroups middleware config.
+	DefaultKeycloakGroupsConfig = KeycloakGroupsConfig{
+		Skipper:          middleware.DefaultSkipper,
+		TokenContextKey:  "user",
+		GroupsContextKey: "groups",
+	}
+)
+
+// KeycloakGroups returns a KeycloakGroups middleware requiring one of the given groups.
+//
+// For valid groups, it sets the groups in context and calls next handler.
+// For invalid groups, it returns "403 - Forbidden" error.
+// For missing token in context, it returns "500 - Internal Server Error" error.
+func KeycloakGroups(groups []string) echo.MiddlewareFunc {
+	c := DefaultKeycloakGroupsConfig
+	c.KeycloakGroups = groups
+	return KeycloakGroupsWithConfig(c)
+}
+
+// KeycloakGroupsWithConfig returns a KeycloakGroups middleware with config.
+// See: `KeycloakGroups()`.
+func KeycloakGroupsWithConfig(config KeycloakGroupsConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultKeycloakGroupsConfig.Skipper
+	}
+	if config.SkipDefaultRoutes {
+		config.Skipper = withDefaultRoutes(config.Skipper)
+	}
+	if len(config.KeycloakGroups) == 0 {
+		panic("echo: keycloak groups middleware requires keycloak groups")
+	}
+	if config.TokenContextKey == "" {
+		config.TokenContextKey = DefaultKeycloakGroupsConfig.TokenContextKey
+	}
+	if config.GroupsContextKey == "" {
+		config.GroupsContextKey = DefaultKeycloakGroupsConfig.GroupsContextKey
+	}
+
+	id := nextMiddlewareID()
+	register := func(r *ProtectedRoute) {
+		r.Groups = append(r.Groups, config.KeycloakGroups)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if registry.probe(c, id, register) {
+				return next(c)
+			}
+			if config.Skipper(c) {
+				return next(c)
+			}
+			registry.protect(c, id, register)
+
+			if config.BeforeFunc != nil {
+				config.BeforeFunc(c)
+			}
+
+			var groups []string
+			claims, err := tokenClaims(c, config.TokenContextKey)
+			if err == nil {
+				groups = extractedGroups(c, claims)
+				err = ErrGroupsInvalid
+				if config.matches(groups) {
+					err = nil
+				}
+			}
+			if err == nil {
+				c.Set(config.GroupsContextKey, groups)
+				publishEvent(c, DecisionAuthorized, "groups", claims, nil)
+				if config.SuccessHandler != nil {
+					config.SuccessHandler(c)
+				}
+				return next(c)
+			}
+			atomic.AddUint64(&stats.Forbidden, 1)
+			publishEvent(c, DecisionForbidden, "groups", claims, err)
+			if config.ErrorHandler != nil {
+				return config.ErrorHandler(err)
+			}
+			if config.ErrorHandlerWithContext != nil {
+				return config.ErrorHandlerWithContext(err, c)
+			}
+			err = &echo.HTTPError{
+				Code:     http.StatusForbidden,
+				Message:  ErrGroupsInvalid.Message,
+				Internal: err,
+			}
+			return respondError(c, err, config.MessageCatalog, config.ErrorBody, config.Negotiate)
+		}
+	}
+}
+
+// matches reports whether one of groups matches one of the required groups.
+func (config *KeycloakGroupsConfig) matches(groups []string) bool {
+	for _, g := range groups {
+		for _, required := range config.KeycloakGroups {
+			if g == required {
+				return true
+			}
+			if config.GroupMatch == SubtreeGroupMatch && strings.HasPrefix(g, strings.TrimRight(required, "/")+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
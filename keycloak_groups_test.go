@@ -0,0 +1,65 @@
+package keycloak
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+func TestKeycloakGroups(t *testing.T) {
+	tests := map[string]struct {
+		match    GroupMatch
+		required []string
+		groups   interface{}
+		status   int
+	}{
+		"Exact":               {ExactGroupMatch, []string{"/org/team"}, []interface{}{"/org/team"}, http.StatusNoContent},
+		"ExactOneOf":          {ExactGroupMatch, []string{"/org/a", "/org/b"}, []interface{}{"/other", "/org/b"}, http.StatusNoContent},
+		"ExactSubgroup":       {ExactGroupMatch, []string{"/org"}, []interface{}{"/org/team"}, http.StatusForbidden},
+		"ExactParent":         {ExactGroupMatch, []string{"/org/team"}, []interface{}{"/org"}, http.StatusForbidden},
+		"Subtree":             {SubtreeGroupMatch, []string{"/org"}, []interface{}{"/org/team/sub"}, http.StatusNoContent},
+		"SubtreeSelf":         {SubtreeGroupMatch, []string{"/org"}, []interface{}{"/org"}, http.StatusNoContent},
+		"SubtreeTrailing":     {SubtreeGroupMatch, []string{"/org/"}, []interface{}{"/org/team"}, http.StatusNoContent},
+		"SubtreeSiblingName":  {SubtreeGroupMatch, []string{"/org"}, []interface{}{"/organization"}, http.StatusForbidden},
+		"SubtreeParent":       {SubtreeGroupMatch, []string{"/org/team"}, []interface{}{"/org"}, http.StatusForbidden},
+		"SubtreeOtherTree":    {SubtreeGroupMatch, []string{"/org"}, []interface{}{"/other/org"}, http.StatusForbidden},
+		"SubtreeCaseMismatch": {SubtreeGroupMatch, []string{"/org"}, []interface{}{"/Org/team"}, http.StatusForbidden},
+		"NoGroups":            {SubtreeGroupMatch, []string{"/org"}, []interface{}{}, http.StatusForbidden},
+		"MissingClaim":        {SubtreeGroupMatch, []string{"/org"}, nil, http.StatusForbidden},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims := jwt.MapClaims{"sub": "alice"}
+			if test.groups != nil {
+				claims["groups"] = test.groups
+			}
+			config := DefaultKeycloakGroupsConfig
+			config.KeycloakGroups = test.required
+			config.GroupMatch = test.match
+			e := testEcho(func(next echo.HandlerFunc) echo.HandlerFunc {
+				return func(c echo.Context) error {
+					c.Set("user", &jwt.Token{Claims: claims, Valid: true})
+					return next(c)
+				}
+			}, KeycloakGroupsWithConfig(config))
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != test.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, test.status, rec.Body)
+			}
+		})
+	}
+
+	t.Run("MissingToken", func(t *testing.T) {
+		e := testEcho(KeycloakGroups([]string{"/org"}))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package keycloak
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Nerzal/gocloak/v5"
+	"github.com/go-resty/resty/v2"
+)
+
+// newGocloakClient returns the gocloak client of config using HTTPClient, TLSConfig,
+// ProxyURL and the configured timeouts for all requests to Keycloak. HTTPClient is
+// copied and the transport is cloned before they are modified, as they may be shared,
+// e.g. http.DefaultTransport.
+func (config *KeycloakConfig) newGocloakClient() gocloak.GoCloak {
+	client := gocloak.NewClient(config.KeycloakURL)
+	if config.HTTPClient != nil {
+		// the timeouts and transports of the verifier must not leak into a client
+		// shared by the application or other verifiers
+		httpClient := *config.HTTPClient
+		client.SetRestyClient(resty.NewWithClient(&httpClient))
+	}
+	restyClient := client.RestyClient()
+	if config.RequestTimeout > 0 {
+		restyClient.SetTimeout(config.RequestTimeout)
+	}
+
+	var proxyURL *url.URL
+	if config.ProxyURL != "" {
+		var err error
+		if proxyURL, err = url.Parse(config.ProxyURL); err != nil {
+			panic("echo: keycloak middleware requires a valid proxy url: " + err.Error())
+		}
+	}
+	transport, ok := restyClient.GetClient().Transport.(*http.Transport)
+	if !ok || (config.TLSConfig == nil && proxyURL == nil && config.ConnectTimeout == 0) {
+		return client
+	}
+	transport = transport.Clone()
+	if config.TLSConfig != nil {
+		transport.TLSClientConfig = config.TLSConfig
+	}
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if config.ConnectTimeout > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   config.ConnectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+	restyClient.SetTransport(transport)
+	return client
+}
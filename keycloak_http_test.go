@@ -0,0 +1,34 @@
+package keycloak
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+)
+
+func TestHTTPClientNotModified(t *testing.T) {
+	kc := keycloaktest.NewServer("http")
+	defer kc.Close()
+	transport := &countingTransport{}
+	client := &http.Client{Transport: transport}
+
+	for i := 0; i < 2; i++ {
+		config := testConfig(kc)
+		config.HTTPClient = client
+		config.CircuitBreaker = &CircuitBreakerConfig{}
+		config.MaxConcurrentRequests = 10
+		config.EagerInit = true
+		v := NewVerifier(config)
+		defer v.Close()
+	}
+	if client.Transport != transport {
+		t.Errorf("HTTPClient transport replaced by %T", client.Transport)
+	}
+	if client.Timeout != 0 {
+		t.Errorf("HTTPClient timeout set to %v", client.Timeout)
+	}
+	if transport.requests == 0 {
+		t.Error("HTTPClient transport not used")
+	}
+}
@@ -0,0 +1,78 @@
+package keycloak
+
+import (
+	"net/http"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+// Identity is the normalized identity of a valid token stored into context with
+// `KeycloakConfig.IdentityContextKey`. It is meant to identify the caller for
+// rate limiting, see `IdentityExtractor()`.
+type Identity struct {
+	// Subject is the sub claim, the user or service account id.
+	Subject string `json:"subject"`
+
+	// Client is the azp claim, the client the token was issued to.
+	Client string `json:"client"`
+
+	// Tenant is the realm which issued the token, taken from the iss claim. Legacy
+	// issuers are mapped to their current realm, see `KeycloakConfig.LegacyIssuers`.
+	Tenant string `json:"tenant"`
+
+	// Actor is the sub claim of the act claim, the current actor of a token exchange
+	// chain, e.g. a service acting on behalf of the subject. Empty without act claim.
+	Actor string `json:"actor,omitempty"`
+}
+
+// Errors
+var (
+	ErrIdentityMissing = echo.NewHTTPError(http.StatusForbidden, "no identity in context found")
+)
+
+// String returns the identity as "<tenant>/<client>/<subject>".
+func (i Identity) String() string {
+	return i.Tenant + "/" + i.Client + "/" + i.Subject
+}
+
+// IdentityExtractor returns a function returning the identity stored in context
+// with contextKey as string, see `Identity.String()`. Its signature matches the
+// IdentifierExtractor of echo's rate limiter middleware, e.g.:
+//
+//	e.Use(middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+//		IdentifierExtractor: keycloak.IdentityExtractor("identity"),
+//		Store:               middleware.NewRateLimiterMemoryStore(10),
+//	}))
+//
+// The rate limiter must be registered after the keycloak middleware.
+func IdentityExtractor(contextKey string) func(echo.Context) (string, error) {
+	return func(c echo.Context) (string, error) {
+		identity, ok := c.Get(contextKey).(Identity)
+		if !ok {
+			return "", ErrIdentityMissing
+		}
+		return identity.String(), nil
+	}
+}
+
+// identity returns the normalized identity of token. The tenant falls back to the
+// configured realm if the token has no iss claim of a realm.
+func (config *KeycloakConfig) identity(token *jwt.Token) Identity {
+	identity := Identity{Tenant: config.KeycloakRealm}
+	claims, ok := mapClaims(token)
+	if !ok {
+		return identity
+	}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Client, _ = claims["azp"].(string)
+	if actor, ok := ActorClaims(claims); ok {
+		identity.Actor, _ = actor["sub"].(string)
+	}
+	if iss, _ := claims["iss"].(string); iss != "" {
+		if realm, ok := config.issuerRealm(iss); ok {
+			identity.Tenant = realm
+		}
+	}
+	return identity
+}
@@ -0,0 +1,64 @@
+package keycloak
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// checkInsecureURL panics for plain-HTTP Keycloak URLs unless the host is a loopback
+// address or allowInsecure is set, in which case a warning is logged.
+func checkInsecureURL(keycloakURL string, allowInsecure bool, logger echo.Logger) {
+	if err := verifyInsecureURL(keycloakURL, allowInsecure, logger); err != nil {
+		panic("echo: keycloak middleware " + err.Error())
+	}
+}
+
+// verifyInsecureURL is `checkInsecureURL()` returning an error instead of panicking.
+func verifyInsecureURL(keycloakURL string, allowInsecure bool, logger echo.Logger) error {
+	u, err := url.Parse(keycloakURL)
+	if err != nil {
+		return errors.New("requires a valid keycloak url: " + err.Error())
+	}
+	if !strings.EqualFold(u.Scheme, "http") {
+		return nil
+	}
+	if !allowInsecure && !isLoopback(u.Hostname()) {
+		return errors.New("requires an https keycloak url, set AllowInsecure to allow " + keycloakURL)
+	}
+	logger.Warnf("keycloak url %s does not use TLS, tokens are sent in plaintext", keycloakURL)
+	return nil
+}
+
+// checkInsecureTLS panics if tlsConfig skips the verification of certificates unless
+// allowInsecure is set, in which case a warning is logged.
+func checkInsecureTLS(tlsConfig *tls.Config, allowInsecure bool, logger echo.Logger) {
+	if err := verifyInsecureTLS(tlsConfig, allowInsecure, logger); err != nil {
+		panic("echo: keycloak middleware " + err.Error())
+	}
+}
+
+// verifyInsecureTLS is `checkInsecureTLS()` returning an error instead of panicking.
+func verifyInsecureTLS(tlsConfig *tls.Config, allowInsecure bool, logger echo.Logger) error {
+	if tlsConfig == nil || !tlsConfig.InsecureSkipVerify {
+		return nil
+	}
+	if !allowInsecure {
+		return errors.New("requires verifying tls certificates, set AllowInsecure to skip verification")
+	}
+	logger.Warn("tls certificates of keycloak are not verified")
+	return nil
+}
+
+// isLoopback reports whether host is localhost or a loopback address.
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,123 @@
+package keycloak
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-resty/resty/v2"
+)
+
+// Errors
+var (
+	ErrTokenInactive = errors.New("token is not active")
+)
+
+const headerCacheControl = "Cache-Control"
+
+// introspectToken validates auth with the introspection endpoint of the realm (RFC 7662)
+// as the client of config and decodes the claims of the response into claims with the
+// ClaimsDecoder. Inactive tokens, e.g. revoked ones, return ErrTokenInactive.
+//
+// It returns the duration the result may be cached, IntrospectionCacheTTL or the
+// max-age of the response if IntrospectionCacheMaxTTL is set. Responses are cached
+// in the TokenCache for this duration, but not beyond the exp claim of active tokens.
+func (config *KeycloakConfig) introspectToken(ctx context.Context, auth string, claims jwt.Claims) (*jwt.Token, time.Duration, error) {
+	key, body, cached := "", []byte(nil), false
+	ttl := config.IntrospectionCacheTTL
+	if config.TokenCache != nil {
+		key = config.cacheKey(cacheKeyIntrospection, auth)
+		body, cached = config.TokenCache.Get(key)
+	}
+	if !cached {
+		resp, err := config.introspect(ctx, auth)
+		if err != nil {
+			return nil, ttl, err
+		}
+		body = resp.Body()
+		if maxAge, ok := cacheControlMaxAge(resp.Header()); ok && config.IntrospectionCacheMaxTTL > 0 {
+			ttl = maxAge
+			if ttl > config.IntrospectionCacheMaxTTL {
+				ttl = config.IntrospectionCacheMaxTTL
+			}
+		}
+	}
+
+	var result struct {
+		Active bool  `json:"active"`
+		Exp    int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, ttl, err
+	}
+	if config.TokenCache != nil && !cached {
+		cacheTTL := ttl
+		if exp := time.Unix(result.Exp, 0).Sub(config.Now()); result.Active && result.Exp > 0 && exp < cacheTTL {
+			cacheTTL = exp
+		}
+		if cacheTTL > 0 {
+			config.TokenCache.Set(key, body, cacheTTL)
+		}
+	}
+	if !result.Active {
+		return nil, ttl, ErrTokenInactive
+	}
+	if err := config.ClaimsDecoder(body, claims); err != nil {
+		return nil, ttl, err
+	}
+	return &jwt.Token{Raw: auth, Header: map[string]interface{}{}, Claims: claims, Valid: true}, ttl, nil
+}
+
+// introspect returns the response of the introspection endpoint for auth.
+func (config *KeycloakConfig) introspect(ctx context.Context, auth string) (*resty.Response, error) {
+	form, err := clientAuthentication(*config)
+	if err != nil {
+		return nil, err
+	}
+	form["token"] = auth
+	form["token_type_hint"] = "access_token"
+
+	resp, err := config.gocloakClient.RestyClient().R().
+		SetContext(ctx).
+		SetFormData(form).
+		Post(config.oidcEndpoints().Introspection)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &unavailableError{err: err}
+	}
+	if resp.StatusCode() >= http.StatusInternalServerError {
+		return nil, &unavailableError{err: fmt.Errorf("could not introspect token: %s", resp.Status())}
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("could not introspect token: %s", resp.Status())
+	}
+	return resp, nil
+}
+
+// cacheControlMaxAge returns the max-age of the Cache-Control header, 0 for no-store
+// and no-cache. It reports false if the header has neither.
+func cacheControlMaxAge(header http.Header) (time.Duration, bool) {
+	maxAge, ok := time.Duration(0), false
+	for _, directive := range strings.Split(header.Get(headerCacheControl), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-store" || directive == "no-cache":
+			return 0, true
+		case strings.HasPrefix(directive, "max-age="):
+			seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			if err != nil || seconds < 0 {
+				return 0, true
+			}
+			maxAge, ok = time.Duration(seconds)*time.Second, true
+		}
+	}
+	return maxAge, ok
+}
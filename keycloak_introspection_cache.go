@@ -0,0 +1,103 @@
+package keycloak
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type (
+	// introspectionCache caches positive and negative introspection results by the
+	// SHA-256 hash of the token, so repeated requests with the same token don't call
+	// the introspection endpoint. Cached tokens are shared between requests and must
+	// not be modified.
+	introspectionCache struct {
+		size int
+
+		mu      sync.RWMutex
+		results map[[sha256.Size]byte]introspectionCacheEntry
+	}
+
+	introspectionCacheEntry struct {
+		token  *jwt.Token
+		err    error
+		expiry time.Time
+	}
+)
+
+func newIntrospectionCache(size int) *introspectionCache {
+	return &introspectionCache{
+		size:    size,
+		results: make(map[[sha256.Size]byte]introspectionCacheEntry, size),
+	}
+}
+
+// get returns the cached introspection result of raw if it is not expired at now.
+func (c *introspectionCache) get(raw string, now time.Time) (*jwt.Token, bool, error) {
+	c.mu.RLock()
+	entry, ok := c.results[sha256.Sum256([]byte(raw))]
+	c.mu.RUnlock()
+	if !ok || !now.Before(entry.expiry) {
+		return nil, false, nil
+	}
+	return entry.token, true, entry.err
+}
+
+// put caches the introspection result of raw for ttl, but not beyond the exp claim of
+// an active token. Only active tokens and ErrTokenInactive are cached, other errors
+// are transient.
+func (c *introspectionCache) put(raw string, token *jwt.Token, err error, ttl time.Duration, now time.Time) {
+	expiry := now.Add(ttl)
+	switch {
+	case err == ErrTokenInactive:
+	case err == nil && token != nil && token.Valid:
+		if _, exp, _ := tokenIDAndExpiry(token); exp.Unix() > 0 && exp.Before(expiry) {
+			expiry = exp
+		}
+	default:
+		return
+	}
+	if !now.Before(expiry) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.results) >= c.size {
+		for hash, entry := range c.results {
+			if !now.Before(entry.expiry) {
+				delete(c.results, hash)
+			}
+		}
+	}
+	if len(c.results) >= c.size {
+		for hash := range c.results {
+			delete(c.results, hash)
+			break
+		}
+	}
+	c.results[sha256.Sum256([]byte(raw))] = introspectionCacheEntry{token: token, err: err, expiry: expiry}
+}
+
+// sweep removes the introspection results expired at now and returns their number.
+func (c *introspectionCache) sweep(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for hash, entry := range c.results {
+		if !now.Before(entry.expiry) {
+			delete(c.results, hash)
+			n++
+		}
+	}
+	return n
+}
+
+// flush removes all cached introspection results.
+func (c *introspectionCache) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results = make(map[[sha256.Size]byte]introspectionCacheEntry, c.size)
+}
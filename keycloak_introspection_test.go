@@ -0,0 +1,46 @@
+package keycloak
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestIntrospectionFallback(t *testing.T) {
+	kc := keycloaktest.NewServer("introspection")
+	defer kc.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/introspect") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		kc.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer down.Close()
+	token := kc.Token(jwt.MapClaims{"sub": "user"})
+
+	for _, fallback := range []bool{false, true} {
+		config := testConfig(kc)
+		config.KeycloakURL = down.URL
+		config.ValidationMode = IntrospectionValidation
+		config.ClientID = "api"
+		config.ClientSecret = "secret"
+		config.IntrospectionFallback = fallback
+		v := NewVerifier(config)
+		_, err := v.ValidateToken(context.Background(), token)
+		v.Close()
+		switch {
+		case fallback && err != nil:
+			t.Errorf("with fallback: unexpected error %v", err)
+		case !fallback && !isUnavailable(err):
+			t.Errorf("without fallback: got error %v, want unavailable", err)
+		case !fallback && kc.CertRequests() > 0:
+			t.Errorf("without fallback: fetched keys %d times", kc.CertRequests())
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package keycloak
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Errors
+var (
+	ErrIssuerInvalid = errors.New("token is not issued by a trusted issuer")
+)
+
+// issuerClaims are claims with an iss claim, e.g. claims embedding jwt.StandardClaims.
+type issuerClaims interface {
+	VerifyIssuer(cmp string, req bool) bool
+}
+
+// verifyIssuer verifies that the iss claim of claims is a trusted issuer.
+func (config *KeycloakConfig) verifyIssuer(claims jwt.Claims) error {
+	var iss string
+	switch c := claims.(type) {
+	case *jwt.MapClaims:
+		iss, _ = (*c)["iss"].(string)
+	case jwt.MapClaims:
+		iss, _ = c["iss"].(string)
+	case issuerClaims:
+		for trusted := range config.trustedIssuers {
+			if c.VerifyIssuer(trusted, true) {
+				return nil
+			}
+		}
+		return ErrIssuerInvalid
+	}
+	if _, ok := config.trustedIssuers[strings.TrimRight(iss, "/")]; !ok {
+		return ErrIssuerInvalid
+	}
+	return nil
+}
+
+// issuerRealm returns the realm of the issuer URL iss. Legacy issuers are mapped to
+// their current realm.
+func (config *KeycloakConfig) issuerRealm(iss string) (string, bool) {
+	iss = strings.TrimRight(iss, "/")
+	if realm, ok := config.LegacyIssuers[iss]; ok {
+		return realm, true
+	}
+	if i := strings.LastIndex(iss, "/realms/"); i >= 0 {
+		return iss[i+len("/realms/"):], true
+	}
+	return "", false
+}
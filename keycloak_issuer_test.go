@@ -0,0 +1,45 @@
+package keycloak
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestValidateIssuer(t *testing.T) {
+	kc := keycloaktest.NewServer("issuer")
+	defer kc.Close()
+
+	tests := map[string]struct {
+		validate bool
+		iss      interface{}
+		status   int
+	}{
+		"NotValidated":      {false, "https://evil.example.com/auth/realms/issuer", http.StatusNoContent},
+		"Realm":             {true, kc.Issuer(), http.StatusNoContent},
+		"TrailingSlash":     {true, kc.Issuer() + "/", http.StatusNoContent},
+		"Trusted":           {true, "https://sso.example.com/auth/realms/issuer", http.StatusNoContent},
+		"Legacy":            {true, "https://old.example.com/auth/realms/legacy", http.StatusNoContent},
+		"OtherRealm":        {true, kc.URL + "/auth/realms/other", http.StatusUnauthorized},
+		"Spoofed":           {true, "https://evil.example.com/auth/realms/issuer", http.StatusUnauthorized},
+		"RealmPrefix":       {true, kc.Issuer() + "-admin", http.StatusUnauthorized},
+		"TrustedPathSuffix": {true, "https://sso.example.com/auth/realms/issuer/x", http.StatusUnauthorized},
+		"Missing":           {true, nil, http.StatusUnauthorized},
+		"NonString":         {true, 42, http.StatusUnauthorized},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := testConfig(kc)
+			config.ValidateIssuer = test.validate
+			config.TrustedIssuers = []string{"https://sso.example.com/auth/realms/issuer/"}
+			config.LegacyIssuers = map[string]string{"https://old.example.com/auth/realms/legacy": kc.Realm}
+			e := testEcho(KeycloakWithConfig(config))
+			rec := serve(e, "/", kc.Token(jwt.MapClaims{"iss": test.iss}))
+			if rec.Code != test.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, test.status, rec.Body)
+			}
+		})
+	}
+}
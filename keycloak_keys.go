@@ -0,0 +1,306 @@
+package keycloak
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// jsonWebKey is a public key of the JSON web key set of a realm (RFC 7517).
+	jsonWebKey struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Alg string `json:"alg"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+
+	// jsonWebKeySet is the JSON web key set of a realm served by its certs endpoint.
+	jsonWebKeySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+)
+
+// keySet caches the public keys of a realm by key id. The keys are fetched again
+// after maxAge or if a token references an unknown key id, e.g. after a key rotation.
+//
+// Fetches are decoupled from the requests waiting for them: a cancelled request stops
+// waiting, but the fetch completes and populates the cache for subsequent requests.
+// Concurrent fetches are coalesced into one. Fetches for unknown key ids and fetches
+// after a failed fetch are started at most once per minInterval, so neither tokens
+// with random key ids nor an unreachable Keycloak cause a flood of fetches.
+// Background refreshes are not limited.
+type keySet struct {
+	fetch       func(initial bool) (map[string]crypto.PublicKey, error)
+	maxAge      time.Duration
+	minInterval time.Duration
+	stale       bool
+	degradation *degradationSource
+
+	mu         sync.RWMutex
+	keys       map[string]crypto.PublicKey
+	fetched    time.Time
+	attempted  time.Time
+	unknownAt  time.Time
+	lastErr    error
+	refreshing *keyRefresh
+}
+
+// keyRefresh is an in-flight fetch of the keys. done is closed when it completes.
+type keyRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+func newKeySet(fetch func(initial bool) (map[string]crypto.PublicKey, error), maxAge, minInterval time.Duration, stale bool) *keySet {
+	return &keySet{
+		fetch:       fetch,
+		maxAge:      maxAge,
+		minInterval: minInterval,
+		stale:       stale,
+	}
+}
+
+// key returns the public key with the given key id. It waits for a fetch of the keys
+// until ctx is done if the key is unknown or the keys are stale. Stale keys are used
+// if the keys cannot be fetched and stale is set. Within minInterval of a failed fetch
+// or of the last fetch for an unknown key id, the keys are not fetched again: the
+// error of the failed fetch is returned and unknown key ids are not found.
+func (k *keySet) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	fresh := time.Since(k.fetched) < k.maxAge
+	unknown := !ok && len(k.keys) > 0
+	lastErr := k.lastErr
+	failing := lastErr != nil && time.Since(k.attempted) < k.minInterval
+	throttled := k.refreshing == nil && (failing || unknown && time.Since(k.unknownAt) < k.minInterval)
+	k.mu.RUnlock()
+	if ok && fresh {
+		return key, nil
+	}
+	if throttled {
+		atomic.AddUint64(&stats.KeyFetchesThrottled, 1)
+		switch {
+		case ok && k.stale:
+			return key, nil
+		case failing && !unknown:
+			return nil, lastErr
+		}
+		return nil, ErrKeyNotFound
+	}
+
+	if unknown {
+		k.mu.Lock()
+		k.unknownAt = time.Now()
+		k.mu.Unlock()
+	}
+	refresh := k.refresh()
+	select {
+	case <-refresh.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if refresh.err != nil {
+		if ok && k.stale {
+			return key, nil
+		}
+		return nil, refresh.err
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if key, ok := k.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrKeyNotFound
+}
+
+// load fetches the keys and waits for the fetch unless the keys are known, e.g. of a
+// shared key set. It fails if no keys are found.
+func (k *keySet) load() error {
+	k.mu.RLock()
+	known := len(k.keys) > 0
+	k.mu.RUnlock()
+	if known {
+		return nil
+	}
+	refresh := k.refresh()
+	<-refresh.done
+	if refresh.err != nil {
+		return refresh.err
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if len(k.keys) == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// refresh returns the in-flight fetch of the keys or starts a new one.
+func (k *keySet) refresh() *keyRefresh {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.refreshing != nil {
+		return k.refreshing
+	}
+	refresh := &keyRefresh{done: make(chan struct{})}
+	k.refreshing = refresh
+	k.attempted = time.Now()
+	go k.runRefresh(refresh)
+	return refresh
+}
+
+// runRefresh fetches the keys of the realm and stores them. The fetch is initial if
+// no keys are known yet.
+func (k *keySet) runRefresh(refresh *keyRefresh) {
+	defer close(refresh.done)
+
+	k.mu.RLock()
+	initial := len(k.keys) == 0
+	k.mu.RUnlock()
+	keys, err := k.fetch(initial)
+	atomic.AddUint64(&stats.KeyFetches, 1)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.refreshing = nil
+	k.lastErr = err
+	refresh.err = err
+	if err != nil {
+		if len(k.keys) > 0 {
+			k.degradation.degrade(DegradedKeys)
+		}
+		return
+	}
+	k.keys = keys
+	k.fetched = time.Now()
+	k.degradation.recover(DegradedKeys)
+}
+
+// refreshEvery refreshes the keys in the background every interval until stop is
+// closed.
+func (k *keySet) refreshEvery(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				<-k.refresh().done
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// flush removes all cached keys.
+func (k *keySet) flush() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = nil
+	k.fetched = time.Time{}
+	k.attempted = time.Time{}
+	k.unknownAt = time.Time{}
+	k.lastErr = nil
+}
+
+// fetchCerts fetches the public keys of the realm, bypassing the cache of the gocloak client.
+// Initial fetches use the certificates of the TokenCache if present, e.g. fetched by
+// another instance, while refreshes always fetch from Keycloak and update the TokenCache.
+func (config *KeycloakConfig) fetchCerts(initial bool) (map[string]crypto.PublicKey, error) {
+	var certs jsonWebKeySet
+	if initial && config.TokenCache != nil {
+		if cached, ok := config.TokenCache.Get(config.cacheKey(cacheKeyCerts, "")); ok {
+			if err := json.Unmarshal(cached, &certs); err == nil {
+				return certs.publicKeys(), nil
+			}
+		}
+	}
+	resp, err := config.gocloakClient.RestyClient().R().
+		Get(config.oidcEndpoints().JWKS)
+	if err != nil {
+		return nil, &unavailableError{err: err}
+	}
+	if resp.StatusCode() >= http.StatusInternalServerError {
+		return nil, &unavailableError{err: fmt.Errorf("could not get certs: %s", resp.Status())}
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("could not get certs: %s", resp.Status())
+	}
+	if err := json.Unmarshal(resp.Body(), &certs); err != nil {
+		return nil, fmt.Errorf("could not decode certs: %v", err)
+	}
+	if config.TokenCache != nil {
+		config.TokenCache.Set(config.cacheKey(cacheKeyCerts, ""), resp.Body(), config.KeysMaxAge)
+	}
+	return certs.publicKeys(), nil
+}
+
+// publicKeys returns the signature keys of the set by key id. Keys without key id and
+// keys which cannot be decoded are skipped.
+func (s *jsonWebKeySet) publicKeys() map[string]crypto.PublicKey {
+	keys := make(map[string]crypto.PublicKey, len(s.Keys))
+	for _, cert := range s.Keys {
+		if cert.Kid == "" || cert.Use == "enc" {
+			continue
+		}
+		if key, err := publicKey(cert); err == nil {
+			keys[cert.Kid] = key
+		}
+	}
+	return keys
+}
+
+// staticKeys returns the public keys of the JSON web key set jwks and the PEM encoded
+// public keys or certificates pemKeys by key id.
+func staticKeys(jwks []byte, pemKeys map[string][]byte) (map[string]crypto.PublicKey, error) {
+	keys := make(map[string]crypto.PublicKey)
+	if jwks != nil {
+		var set jsonWebKeySet
+		if err := json.Unmarshal(jwks, &set); err != nil {
+			return nil, err
+		}
+		keys = set.publicKeys()
+	}
+	for kid, data := range pemKeys {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("key %q is not PEM encoded", kid)
+		}
+		var key crypto.PublicKey
+		var err error
+		switch block.Type {
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+				key = cert.PublicKey
+			}
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		default:
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %v", kid, err)
+		}
+		keys[kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no keys")
+	}
+	return keys, nil
+}
@@ -0,0 +1,116 @@
+package keycloak
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestKeySetCancelledWaiter(t *testing.T) {
+	key := &rsa.PublicKey{N: big.NewInt(1), E: 65537}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var fetches uint64
+	k := newKeySet(func(bool) (map[string]crypto.PublicKey, error) {
+		if atomic.AddUint64(&fetches, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return map[string]crypto.PublicKey{"kid": key}, nil
+	}, time.Minute, time.Minute, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error, 1)
+	go func() {
+		_, err := k.key(ctx, "kid")
+		cancelled <- err
+	}()
+	<-started
+	waiting := make(chan error, 1)
+	go func() {
+		got, err := k.key(context.Background(), "kid")
+		if err == nil && got != key {
+			t.Errorf("waiter got key %v, want %v", got, key)
+		}
+		waiting <- err
+	}()
+
+	cancel()
+	if err := <-cancelled; err != context.Canceled {
+		t.Fatalf("cancelled waiter: got error %v, want %v", err, context.Canceled)
+	}
+	close(release)
+	if err := <-waiting; err != nil {
+		t.Fatalf("waiter: unexpected error %v", err)
+	}
+	if got, err := k.key(context.Background(), "kid"); err != nil || got != key {
+		t.Fatalf("after fetch: got key %v and error %v", got, err)
+	}
+	if n := atomic.LoadUint64(&fetches); n != 1 {
+		t.Fatalf("expected 1 fetch, got %d", n)
+	}
+}
+
+func TestValidateTokenCancelledDuringKeyFetch(t *testing.T) {
+	kc := keycloaktest.NewServer("cancel")
+	defer kc.Close()
+	fetching := make(chan struct{}, 1)
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/certs") {
+			fetching <- struct{}{}
+			<-release
+		}
+		kc.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer slow.Close()
+	var once sync.Once
+	unblock := func() { once.Do(func() { close(release) }) }
+	defer unblock()
+
+	config := testConfig(kc)
+	config.KeycloakURL = slow.URL
+	v := NewVerifier(config)
+	defer v.Close()
+	token := kc.Token(jwt.MapClaims{"sub": "user"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error, 1)
+	go func() {
+		_, err := v.ValidateToken(ctx, token)
+		cancelled <- err
+	}()
+	<-fetching
+	waiting := make(chan error, 1)
+	go func() {
+		_, err := v.ValidateToken(context.Background(), token)
+		waiting <- err
+	}()
+
+	cancel()
+	err := <-cancelled
+	if verr, ok := err.(*jwt.ValidationError); !ok || verr.Inner != context.Canceled {
+		t.Fatalf("cancelled request: got error %v, want %v", err, context.Canceled)
+	}
+	unblock()
+	if err := <-waiting; err != nil {
+		t.Fatalf("waiting request: unexpected error %v", err)
+	}
+	if _, err := v.ValidateToken(context.Background(), token); err != nil {
+		t.Fatalf("request after fetch: unexpected error %v", err)
+	}
+	if n := kc.CertRequests(); n != 1 {
+		t.Fatalf("expected 1 key fetch, got %d", n)
+	}
+}
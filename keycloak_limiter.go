@@ -0,0 +1,37 @@
+package keycloak
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Errors
+var (
+	ErrTooManyRequests = errors.New("too many concurrent requests to keycloak")
+)
+
+// concurrencyLimiter is a http.RoundTripper limiting the number of concurrent requests.
+// Requests exceeding the limit fail immediately instead of queueing, so a slow Keycloak
+// cannot pile up waiting requests.
+type concurrencyLimiter struct {
+	next  http.RoundTripper
+	slots chan struct{}
+}
+
+func newConcurrencyLimiter(limit int, next http.RoundTripper) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		next:  next,
+		slots: make(chan struct{}, limit),
+	}
+}
+
+// RoundTrip sends the request if a slot is free.
+func (l *concurrencyLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		return nil, ErrTooManyRequests
+	}
+	defer func() { <-l.slots }()
+	return l.next.RoundTrip(req)
+}
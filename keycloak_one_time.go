@@ -0,0 +1,125 @@
+package keycloak
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Errors
+var (
+	ErrTokenReplayed        = errors.New("one-time token already used")
+	ErrTokenLifetimeTooLong = errors.New("one-time token expires too late")
+	ErrTokenIDMissing       = errors.New("one-time token has no jti or exp claim")
+)
+
+// Cache key kind of used one-time tokens
+const cacheKeyUsedToken = "used-token"
+
+// usedTokens records the jti of used one-time tokens until they expire, including
+// the leeway accepting expired tokens. With a TokenCache the jti are recorded in the
+// cache, so they are shared by all instances, and in memory otherwise.
+type usedTokens struct {
+	maxAge   time.Duration
+	leeway   time.Duration
+	cache    TokenCache
+	cacheKey func(id string) string
+
+	mu    sync.Mutex
+	ids   map[string]time.Time
+	swept time.Time
+}
+
+func newUsedTokens(maxAge, leeway time.Duration, cache TokenCache, cacheKey func(id string) string) *usedTokens {
+	return &usedTokens{
+		maxAge:   maxAge,
+		leeway:   leeway,
+		cache:    cache,
+		cacheKey: cacheKey,
+		ids:      make(map[string]time.Time),
+	}
+}
+
+// use marks the token as used. It fails if the token was used before, has no
+// jti or exp claim or expires later than maxAge from now.
+//
+// TokenCaches implementing TokenCacheAdder record the jti atomically. Others are
+// checked with Get before Set, so concurrent requests of other instances with the
+// same token may both be accepted.
+func (u *usedTokens) use(token *jwt.Token, now time.Time) error {
+	jti, exp, ok := tokenIDAndExpiry(token)
+	if !ok {
+		return ErrTokenIDMissing
+	}
+	if exp.Sub(now) > u.maxAge {
+		return ErrTokenLifetimeTooLong
+	}
+	ttl := exp.Add(u.leeway).Sub(now)
+
+	if u.cache != nil {
+		key := u.cacheKey(jti)
+		if adder, ok := u.cache.(TokenCacheAdder); ok {
+			if !adder.Add(key, []byte{1}, ttl) {
+				return ErrTokenReplayed
+			}
+			return nil
+		}
+		if _, used := u.cache.Get(key); used {
+			return ErrTokenReplayed
+		}
+		u.cache.Set(key, []byte{1}, ttl)
+		return nil
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if now.Sub(u.swept) >= u.maxAge {
+		u.sweepLocked(now)
+	}
+	if expiry, used := u.ids[jti]; used && !expiry.Before(now) {
+		return ErrTokenReplayed
+	}
+	u.ids[jti] = exp.Add(u.leeway)
+	return nil
+}
+
+// sweep removes the jti of tokens expired at now and returns their number.
+func (u *usedTokens) sweep(now time.Time) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.sweepLocked(now)
+}
+
+func (u *usedTokens) sweepLocked(now time.Time) int {
+	u.swept = now
+	n := 0
+	for id, expiry := range u.ids {
+		if expiry.Before(now) {
+			delete(u.ids, id)
+			n++
+		}
+	}
+	return n
+}
+
+// tokenIDAndExpiry returns the jti and exp claims of token.
+func tokenIDAndExpiry(token *jwt.Token) (string, time.Time, bool) {
+	return claimsIDAndExpiry(token.Claims)
+}
+
+// claimsIDAndExpiry returns the jti and exp claims of claims.
+func claimsIDAndExpiry(claims jwt.Claims) (string, time.Time, bool) {
+	jti, _ := claimString(claims, "jti")
+	exp, _ := claimValue(claims, "exp")
+	var sec int64
+	switch exp := exp.(type) {
+	case float64:
+		sec = int64(exp)
+	case json.Number:
+		sec, _ = exp.Int64()
+	}
+	return jti, time.Unix(sec, 0), jti != "" && sec != 0
+}
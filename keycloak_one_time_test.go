@@ -0,0 +1,64 @@
+package keycloak
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestUsedTokens(t *testing.T) {
+	now := time.Now()
+	token := func(claims jwt.Claims) *jwt.Token {
+		return &jwt.Token{Claims: claims, Valid: true}
+	}
+	exp := now.Add(time.Minute).Unix()
+
+	for name, cache := range map[string]TokenCache{"Memory": nil, "TokenCache": NewMemoryCache(10)} {
+		t.Run(name, func(t *testing.T) {
+			u := newUsedTokens(5*time.Minute, 0, cache, func(id string) string { return "used:" + id })
+			tests := []struct {
+				claims jwt.Claims
+				err    error
+			}{
+				{jwt.MapClaims{"jti": "a", "exp": float64(exp)}, nil},
+				{jwt.MapClaims{"jti": "a", "exp": float64(exp)}, ErrTokenReplayed},
+				{jwt.MapClaims{"jti": "b", "exp": json.Number("1")}, nil},
+				{&jwt.StandardClaims{Id: "c", ExpiresAt: exp}, nil},
+				{&jwt.StandardClaims{Id: "c", ExpiresAt: exp}, ErrTokenReplayed},
+				{jwt.MapClaims{"exp": float64(exp)}, ErrTokenIDMissing},
+				{jwt.MapClaims{"jti": "d", "exp": float64(now.Add(time.Hour).Unix())}, ErrTokenLifetimeTooLong},
+			}
+			for i, test := range tests {
+				if err := u.use(token(test.claims), now); err != test.err {
+					t.Errorf("%d: use() = %v, want %v", i, err, test.err)
+				}
+			}
+		})
+	}
+}
+
+func TestUsedTokensConcurrent(t *testing.T) {
+	now := time.Now()
+	u := newUsedTokens(5*time.Minute, 0, NewMemoryCache(10), func(id string) string { return id })
+	token := &jwt.Token{Claims: jwt.MapClaims{"jti": "a", "exp": float64(now.Add(time.Minute).Unix())}}
+
+	var accepted int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if u.use(token, now) == nil {
+				atomic.AddInt32(&accepted, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted != 1 {
+		t.Errorf("accepted %d uses, want 1", accepted)
+	}
+}
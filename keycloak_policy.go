@@ -0,0 +1,268 @@
+package keycloak
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type (
+	// KeycloakPolicyConfig defines the config for the KeycloakPolicy middleware.
+	KeycloakPolicyConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper middleware.Skipper
+
+		// SkipDefaultRoutes additionally skips OPTIONS requests and the paths in
+		// `DefaultSkipPaths` (health, metrics and favicon routes).
+		// Optional. Default value false.
+		SkipDefaultRoutes bool
+
+		// BeforeFunc defines a function which is executed just before the middleware.
+		BeforeFunc middleware.BeforeFunc
+
+		// SuccessHandler defines a function which is executed for a permitted request.
+		SuccessHandler KeycloakSuccessHandler
+
+		// ErrorHandler defines a function which is executed for a denied request.
+		// It may be used to define a custom KeycloakPolicy error.
+		ErrorHandler KeycloakErrorHandler
+
+		// ErrorHandlerWithContext is almost identical to ErrorHandler, but it's passed the current context.
+		ErrorHandlerWithContext KeycloakErrorHandlerWithContext
+
+		// MessageCatalog translates error messages into the language requested by
+		// the Accept-Language header. It is only used if neither ErrorHandler nor
+		// ErrorHandlerWithContext is set.
+		// Optional. See `MapMessageCatalog()`.
+		MessageCatalog KeycloakMessageCatalog
+
+		// ErrorBody defines the response body of errors, e.g. a brand-consistent
+		// JSON envelope. It is only used if neither ErrorHandler nor
+		// ErrorHandlerWithContext is set.
+		// Optional. Default body is {"message": "<error message>"}.
+		ErrorBody KeycloakErrorBodyFunc
+
+		// Negotiate renders errors as JSON, HTML or plain text depending on the
+		// Accept header of the request. It is only used if neither ErrorHandler
+		// nor ErrorHandlerWithContext is set.
+		// Optional.
+		Negotiate *NegotiateConfig
+
+		// Endpoint is the URL of the policy decision point (PDP). The encoded
+		// request is sent as JSON with POST.
+		Endpoint string
+
+		// HTTPClient is used for requests to Endpoint.
+		// Optional. Default value is a client with a timeout of 5 seconds.
+		HTTPClient *http.Client
+
+		// EncodeRequest returns the body sent to Endpoint, e.g. to match the request
+		// schema of the PDP.
+		// Optional. Default value sends the PolicyRequest.
+		EncodeRequest func(echo.Context, PolicyRequest) interface{}
+
+		// DecodeDecision decodes the response body of Endpoint, e.g. to match the
+		// response schema of the PDP.
+		// Optional. Default value decodes a PolicyDecision.
+		DecodeDecision func([]byte) (PolicyDecision, error)
+
+		// TokenContextKey is the context key which stores the keycloak jwt token
+		// Optional. Default value "user".
+		TokenContextKey string
+	}
+
+	// PolicyRequest is the default request sent to the policy decision point.
+	PolicyRequest struct {
+		// Subject is the sub claim of the token.
+		Subject string `json:"subject"`
+
+		// Roles are the realm roles of the token.
+		Roles []string `json:"roles"`
+
+		// Groups are the groups of the token.
+		Groups []string `json:"groups"`
+
+		// Method is the HTTP method of the request.
+		Method string `json:"method"`
+
+		// Path is the route pattern of the request, e.g. "/users/:id".
+		Path string `json:"path"`
+
+		// Params are the path parameters of the request.
+		Params map[string]string `json:"params"`
+
+		// Claims are all claims of the token.
+		Claims jwt.MapClaims `json:"claims"`
+	}
+
+	// PolicyDecision is the decision of the policy decision point.
+	PolicyDecision struct {
+		// Allow reports whether the request is permitted.
+		Allow bool `json:"allow"`
+
+		// Reason describes the decision.
+		Reason string `json:"reason,omitempty"`
+	}
+)
+
+// Errors
+var (
+	ErrPolicyDenied      = echo.NewHTTPError(http.StatusForbidden, "denied by policy")
+	ErrPolicyUnavailable = echo.NewHTTPError(http.StatusServiceUnavailable, "policy service unavailable")
+)
+
+var (
+	// DefaultKeycloakPolicyConfig is the default KeycloakPolicy middleware config.
+	DefaultKeycloakPolicyConfig = KeycloakPolicyConfig{
+		Skipper:         middleware.DefaultSkipper,
+		TokenContextKey: "user",
+	}
+)
+
+// KeycloakPolicy returns a KeycloakPolicy middleware asking an external policy decision
+// point at endpoint whether the request is permitted, e.g. a homegrown authorization
+// service.
+//
+// For permitted requests, it calls next handler.
+// For denied requests, it returns "403 - Forbidden" error.
+// For failing requests to the PDP, it returns "503 - Service Unavailable" error.
+// For missing token in context, it returns "500 - Internal Server Error" error.
+func KeycloakPolicy(endpoint string) echo.MiddlewareFunc {
+	c := DefaultKeycloakPolicyConfig
+	c.Endpoint = endpoint
+	return KeycloakPolicyWithConfig(c)
+}
+
+// KeycloakPolicyWithConfig returns a KeycloakPolicy middleware with config.
+// See: `KeycloakPolicy()`.
+func KeycloakPolicyWithConfig(config KeycloakPolicyConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultKeycloakPolicyConfig.Skipper
+	}
+	if config.SkipDefaultRoutes {
+		config.Skipper = withDefaultRoutes(config.Skipper)
+	}
+	if config.Endpoint == "" {
+		panic("echo: keycloak policy middleware requires endpoint")
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	if config.TokenContextKey == "" {
+		config.TokenContextKey = DefaultKeycloakPolicyConfig.TokenContextKey
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			if config.BeforeFunc != nil {
+				config.BeforeFunc(c)
+			}
+
+			var decision PolicyDecision
+			claims, err := tokenClaims(c, config.TokenContextKey)
+			if err == nil {
+				decision, err = config.decide(c, claims)
+			}
+			if err == nil && decision.Allow {
+				publishEvent(c, DecisionAuthorized, "policy", claims, nil)
+				if config.SuccessHandler != nil {
+					config.SuccessHandler(c)
+				}
+				return next(c)
+			}
+			atomic.AddUint64(&stats.Forbidden, 1)
+			if err == nil {
+				err = ErrPolicyDenied
+			}
+			publishEvent(c, DecisionForbidden, "policy", claims, err)
+			if config.ErrorHandler != nil {
+				return config.ErrorHandler(err)
+			}
+			if config.ErrorHandlerWithContext != nil {
+				return config.ErrorHandlerWithContext(err, c)
+			}
+			switch err {
+			case ErrClaimsMissing:
+			case ErrPolicyDenied:
+				if decision.Reason != "" {
+					err = &echo.HTTPError{
+						Code:     ErrPolicyDenied.Code,
+						Message:  ErrPolicyDenied.Message,
+						Internal: errors.New(decision.Reason),
+					}
+				}
+			default:
+				err = &echo.HTTPError{
+					Code:     ErrPolicyUnavailable.Code,
+					Message:  ErrPolicyUnavailable.Message,
+					Internal: err,
+				}
+			}
+			return respondError(c, err, config.MessageCatalog, config.ErrorBody, config.Negotiate)
+		}
+	}
+}
+
+// decide asks the policy decision point whether the request of c with claims is permitted.
+func (config *KeycloakPolicyConfig) decide(c echo.Context, claims jwt.MapClaims) (PolicyDecision, error) {
+	request := PolicyRequest{
+		Method: c.Request().Method,
+		Path:   c.Path(),
+		Params: make(map[string]string, len(c.ParamNames())),
+		Groups: extractedGroups(c, claims),
+		Claims: claims,
+	}
+	request.Subject, _ = claims["sub"].(string)
+	request.Roles, _ = extractedRealmRoles(c, claims)
+	for _, name := range c.ParamNames() {
+		request.Params[name] = c.Param(name)
+	}
+	var body interface{} = request
+	if config.EncodeRequest != nil {
+		body = config.EncodeRequest(c, request)
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return PolicyDecision{}, err
+	}
+	req, err := http.NewRequest(http.MethodPost, config.Endpoint, bytes.NewReader(b))
+	if err != nil {
+		return PolicyDecision{}, err
+	}
+	req = req.WithContext(c.Request().Context())
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	resp, err := config.HTTPClient.Do(req)
+	if err != nil {
+		return PolicyDecision{}, err
+	}
+	defer resp.Body.Close()
+	b, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return PolicyDecision{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return PolicyDecision{}, fmt.Errorf("policy decision point responded %s", resp.Status)
+	}
+
+	if config.DecodeDecision != nil {
+		return config.DecodeDecision(b)
+	}
+	var decision PolicyDecision
+	err = json.Unmarshal(b, &decision)
+	return decision, err
+}
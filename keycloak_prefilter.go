@@ -0,0 +1,40 @@
+package keycloak
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/thoas/go-funk"
+)
+
+// Errors
+var (
+	ErrTokenRejected = errors.New("token rejected by pre-filter")
+)
+
+// TokenPreFilter returns a KeycloakPreFilter rejecting tokens longer than maxLength,
+// tokens which are not made of three base64url segments and, if issuers are given,
+// tokens whose unverified iss claim is none of issuers.
+func TokenPreFilter(maxLength int, issuers ...string) KeycloakPreFilter {
+	return func(token string) error {
+		if len(token) > maxLength || strings.Count(token, ".") != 2 || !isTokenString(token) {
+			return ErrTokenRejected
+		}
+		if len(issuers) == 0 {
+			return nil
+		}
+		payload, err := jwt.DecodeSegment(strings.Split(token, ".")[1])
+		if err != nil {
+			return ErrTokenRejected
+		}
+		var claims struct {
+			Iss string `json:"iss"`
+		}
+		if err := json.Unmarshal(payload, &claims); err != nil || !funk.ContainsString(issuers, claims.Iss) {
+			return ErrTokenRejected
+		}
+		return nil
+	}
+}
@@ -0,0 +1,221 @@
+package keycloak
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+type (
+	// RedisCacheConfig defines the config of a Redis TokenCache.
+	RedisCacheConfig struct {
+		// Addr is the address of the Redis server, e.g. "localhost:6379".
+		Addr string
+
+		// Password authenticates the connections.
+		// Optional.
+		Password string
+
+		// DB is the database used.
+		// Optional. Default value 0.
+		DB int
+
+		// Timeout limits dialing and every command.
+		// Optional. Default value 1 second.
+		Timeout time.Duration
+
+		// PoolSize is the maximum number of idle connections.
+		// Optional. Default value 10.
+		PoolSize int
+	}
+
+	// redisCache is a TokenCache of a Redis server, shared by multiple instances.
+	redisCache struct {
+		config RedisCacheConfig
+		idle   chan *redisConn
+	}
+
+	redisConn struct {
+		net.Conn
+		r *bufio.Reader
+	}
+)
+
+var (
+	// DefaultRedisCacheConfig is the default Redis TokenCache config.
+	DefaultRedisCacheConfig = RedisCacheConfig{
+		Timeout:  time.Second,
+		PoolSize: 10,
+	}
+)
+
+var errRedisNil = errors.New("redis: nil")
+
+// NewRedisCache returns a TokenCache of a Redis server speaking the Redis protocol
+// (RESP) without further dependencies. Failing commands are treated as cache misses,
+// except by the CheckedTokenCache methods.
+func NewRedisCache(config RedisCacheConfig) TokenCache {
+	if config.Addr == "" {
+		panic("echo: keycloak redis cache requires addr")
+	}
+	if config.Timeout == 0 {
+		config.Timeout = DefaultRedisCacheConfig.Timeout
+	}
+	if config.PoolSize == 0 {
+		config.PoolSize = DefaultRedisCacheConfig.PoolSize
+	}
+	return &redisCache{
+		config: config,
+		idle:   make(chan *redisConn, config.PoolSize),
+	}
+}
+
+func (c *redisCache) Get(key string) ([]byte, bool) {
+	value, ok, _ := c.Lookup(key)
+	return value, ok
+}
+
+func (c *redisCache) Set(key string, value []byte, ttl time.Duration) {
+	c.Store(key, value, ttl)
+}
+
+func (c *redisCache) Lookup(key string) ([]byte, bool, error) {
+	reply, err := c.do("GET", key)
+	if err == errRedisNil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	return value, ok, nil
+}
+
+func (c *redisCache) Store(key string, value []byte, ttl time.Duration) error {
+	ms := ttl.Nanoseconds() / int64(time.Millisecond)
+	if ms <= 0 {
+		return nil
+	}
+	_, err := c.do("SET", key, string(value), "PX", strconv.FormatInt(ms, 10))
+	return err
+}
+
+// Add stores value with SET NX. Failing commands are reported as not stored.
+func (c *redisCache) Add(key string, value []byte, ttl time.Duration) bool {
+	ms := ttl.Nanoseconds() / int64(time.Millisecond)
+	if ms <= 0 {
+		return false
+	}
+	reply, err := c.do("SET", key, string(value), "PX", strconv.FormatInt(ms, 10), "NX")
+	return err == nil && reply == "OK"
+}
+
+func (c *redisCache) Delete(key string) {
+	c.do("DEL", key)
+}
+
+// do sends a command with a pooled connection and returns its reply.
+func (c *redisCache) do(args ...string) (interface{}, error) {
+	conn, err := c.conn()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.do(c.config.Timeout, args...)
+	if err != nil && err != errRedisNil {
+		conn.Close()
+		return nil, err
+	}
+	select {
+	case c.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return reply, err
+}
+
+// conn returns an idle connection or dials a new one.
+func (c *redisCache) conn() (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+	nc, err := net.DialTimeout("tcp", c.config.Addr, c.config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	if c.config.Password != "" {
+		if _, err := conn.do(c.config.Timeout, "AUTH", c.config.Password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if c.config.DB != 0 {
+		if _, err := conn.do(c.config.Timeout, "SELECT", strconv.Itoa(c.config.DB)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// do writes a command and reads its reply.
+func (conn *redisConn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	cmd := make([]byte, 0, 64)
+	cmd = append(cmd, '*')
+	cmd = strconv.AppendInt(cmd, int64(len(args)), 10)
+	cmd = append(cmd, '\r', '\n')
+	for _, arg := range args {
+		cmd = append(cmd, '$')
+		cmd = strconv.AppendInt(cmd, int64(len(arg)), 10)
+		cmd = append(cmd, '\r', '\n')
+		cmd = append(cmd, arg...)
+		cmd = append(cmd, '\r', '\n')
+	}
+	if _, err := conn.Write(cmd); err != nil {
+		return nil, err
+	}
+	return conn.reply()
+}
+
+// reply reads a simple string, error, integer or bulk string reply.
+func (conn *redisConn) reply() (interface{}, error) {
+	line, err := conn.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: invalid reply %q", line)
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("redis: %s", line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		value := make([]byte, n+2)
+		if _, err := io.ReadFull(conn.r, value); err != nil {
+			return nil, err
+		}
+		return value[:n], nil
+	}
+	return nil, fmt.Errorf("redis: unsupported reply %q", line)
+}
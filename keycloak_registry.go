@@ -0,0 +1,245 @@
+package keycloak
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// ProtectedRoute describes a route and the requirements of the middlewares of this
+	// package protecting it.
+	ProtectedRoute struct {
+		// Method is the HTTP method of the route.
+		Method string `json:"method"`
+
+		// Path is the route pattern, e.g. "/users/:id".
+		Path string `json:"path"`
+
+		// Realm is the realm the token must be issued by.
+		Realm string `json:"realm,omitempty"`
+
+		// Roles are the roles required by each roles middleware of the route.
+		// The token must have one role of every entry.
+		Roles [][]string `json:"roles,omitempty"`
+
+		// Groups are the groups required by each groups middleware of the route.
+		// The token must have one group of every entry.
+		Groups [][]string `json:"groups,omitempty"`
+
+		// Scopes are the scopes required by each scopes middleware of the route.
+		// The token must have all scopes of every entry.
+		Scopes [][]string `json:"scopes,omitempty"`
+
+		// ServiceAccount reports whether the route accepts only service-account tokens.
+		ServiceAccount bool `json:"serviceAccount,omitempty"`
+
+		// UsersOnly reports whether the route rejects service-account tokens.
+		UsersOnly bool `json:"usersOnly,omitempty"`
+
+		// Protected reports whether a middleware of this package protects the route.
+		// Routes without are listed to spot unprotected routes.
+		Protected bool `json:"protected"`
+	}
+
+	// RouteAdder adds routes, e.g. *echo.Echo and *echo.Group.
+	RouteAdder interface {
+		Add(method, path string, handler echo.HandlerFunc, middleware ...echo.MiddlewareFunc) *echo.Route
+	}
+
+	// routeRegistry records the requirements of the middlewares of this package by
+	// route, declared at setup or observed with requests.
+	routeRegistry struct {
+		mu       sync.RWMutex
+		declared map[routeKey]routeRequirements
+		prefixes map[string]routeRequirements
+		observed map[routeKey]routeRequirements
+	}
+
+	routeKey struct {
+		method, path string
+	}
+
+	// routeRequirements are the updates of a ProtectedRoute by middleware id.
+	routeRequirements map[uint64]func(*ProtectedRoute)
+
+	// registryProbe collects the requirements of middlewares executed with it.
+	registryProbe struct {
+		requirements routeRequirements
+	}
+
+	// discardResponseWriter is the response writer of probes.
+	discardResponseWriter struct {
+		header http.Header
+	}
+)
+
+const registryProbeContextKey = "_keycloak_registry_probe"
+
+var (
+	registry = &routeRegistry{
+		declared: make(map[routeKey]routeRequirements),
+		prefixes: make(map[string]routeRequirements),
+		observed: make(map[routeKey]routeRequirements),
+	}
+	middlewareIDs uint64
+)
+
+// AddRoute adds a route to r like `echo.Echo.Add()` and declares the requirements of
+// the middlewares of this package among middleware for `Registry()`, so the route is
+// listed with its requirements before its first request. Other middlewares are
+// executed once with a probe request, without the handler.
+func AddRoute(r RouteAdder, method, path string, handler echo.HandlerFunc, middleware ...echo.MiddlewareFunc) *echo.Route {
+	route := r.Add(method, path, handler, middleware...)
+	requirements := probeRequirements(middleware)
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.declared[routeKey{method: route.Method, path: route.Path}] = requirements
+	return route
+}
+
+// AddGroup creates a group of e with prefix and middleware like `echo.Echo.Group()` and
+// declares the requirements of the middlewares of this package among middleware for
+// all routes below prefix, see `AddRoute()`.
+func AddGroup(e *echo.Echo, prefix string, middleware ...echo.MiddlewareFunc) *echo.Group {
+	g := e.Group(prefix, middleware...)
+	requirements := probeRequirements(middleware)
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.prefixes[prefix] = requirements
+	return g
+}
+
+// Registry returns every route of e with the requirements of the middlewares of this
+// package protecting it, ordered by path and method, e.g. for security reviews.
+//
+// Requirements are declared at setup by routes and groups added with `AddRoute()` and
+// `AddGroup()`. Middlewares added with the API of echo cannot be inspected before
+// they handle a request, so their requirements are listed from the first request of
+// the route on. Routes without requirements are listed as not protected.
+func Registry(e *echo.Echo) []ProtectedRoute {
+	notFound := handlerName(echo.NotFoundHandler)
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	seen := make(map[routeKey]struct{})
+	var routes []ProtectedRoute
+	for _, r := range e.Routes() {
+		key := routeKey{method: r.Method, path: r.Path}
+		if _, ok := seen[key]; ok || r.Name == notFound {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		requirements := make(routeRequirements)
+		for prefix, declared := range registry.prefixes {
+			if r.Path == prefix || strings.HasPrefix(r.Path, strings.TrimRight(prefix, "/")+"/") {
+				requirements.add(declared)
+			}
+		}
+		requirements.add(registry.declared[key])
+		requirements.add(registry.observed[key])
+		routes = append(routes, requirements.route(key))
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// nextMiddlewareID returns a unique id of a middleware instance.
+func nextMiddlewareID() uint64 {
+	return atomic.AddUint64(&middlewareIDs, 1)
+}
+
+// probe registers the requirements of the middleware with id for probes of
+// `AddRoute()` and `AddGroup()` and reports whether c is a probe, the middleware must
+// call the next handler without further checks then.
+func (r *routeRegistry) probe(c echo.Context, id uint64, update func(*ProtectedRoute)) bool {
+	probe, ok := c.Get(registryProbeContextKey).(*registryProbe)
+	if ok {
+		probe.requirements[id] = update
+	}
+	return ok
+}
+
+// protect registers the requirements of the middleware with id for the route of the
+// request.
+func (r *routeRegistry) protect(c echo.Context, id uint64, update func(*ProtectedRoute)) {
+	route := routeKey{method: c.Request().Method, path: c.Path()}
+
+	r.mu.RLock()
+	_, seen := r.observed[route][id]
+	r.mu.RUnlock()
+	if seen {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	requirements, ok := r.observed[route]
+	if !ok {
+		requirements = make(routeRequirements)
+		r.observed[route] = requirements
+	}
+	requirements[id] = update
+}
+
+// probeRequirements returns the requirements of the middlewares of this package among
+// middlewares by executing each with a probe request.
+func probeRequirements(middlewares []echo.MiddlewareFunc) routeRequirements {
+	probe := &registryProbe{requirements: make(routeRequirements)}
+	terminal := func(echo.Context) error { return nil }
+	for _, m := range middlewares {
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		c := echo.New().NewContext(req, &discardResponseWriter{header: make(http.Header)})
+		c.Set(registryProbeContextKey, probe)
+		m(terminal)(c)
+	}
+	return probe.requirements
+}
+
+// add adds the requirements of other.
+func (r routeRequirements) add(other routeRequirements) {
+	for id, update := range other {
+		r[id] = update
+	}
+}
+
+// route returns the route of key with the requirements applied in the order the
+// middlewares were created.
+func (r routeRequirements) route(key routeKey) ProtectedRoute {
+	ids := make([]uint64, 0, len(r))
+	for id := range r {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	route := ProtectedRoute{Method: key.method, Path: key.path, Protected: len(ids) > 0}
+	for _, id := range ids {
+		r[id](&route)
+	}
+	return route
+}
+
+// handlerName returns the name of the function h, like echo names route handlers.
+func handlerName(h echo.HandlerFunc) string {
+	return runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+}
+
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardResponseWriter) WriteHeader(int) {}
@@ -0,0 +1,48 @@
+package keycloak
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/labstack/echo/v4"
+)
+
+func TestRegistry(t *testing.T) {
+	kc := keycloaktest.NewServer("registry")
+	defer kc.Close()
+	verifier := NewVerifier(testConfig(kc))
+	handler := func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	e := echo.New()
+	AddRoute(e, http.MethodGet, "/registry/orders", handler,
+		verifier.Middleware(), KeycloakRoles([]string{"orders"}), KeycloakScopes([]string{"orders:read"}))
+	admin := AddGroup(e, "/registry/admin", verifier.Middleware(), KeycloakServiceAccounts())
+	AddRoute(admin, http.MethodDelete, "/users", handler, KeycloakGroups([]string{"/admins"}))
+	e.GET("/registry/observed", handler, verifier.Middleware(), KeycloakUsers())
+	e.GET("/registry/public", handler)
+
+	want := []ProtectedRoute{
+		{Method: http.MethodDelete, Path: "/registry/admin/users", Realm: "registry",
+			Groups: [][]string{{"/admins"}}, ServiceAccount: true, Protected: true},
+		{Method: http.MethodGet, Path: "/registry/observed", Protected: false},
+		{Method: http.MethodGet, Path: "/registry/orders", Realm: "registry",
+			Roles: [][]string{{"orders"}}, Scopes: [][]string{{"orders:read"}}, Protected: true},
+		{Method: http.MethodGet, Path: "/registry/public", Protected: false},
+	}
+	if routes := Registry(e); !reflect.DeepEqual(routes, want) {
+		t.Fatalf("routes = %+v, want %+v", routes, want)
+	}
+
+	// Middlewares added with the API of echo are listed from the first request on.
+	if rec := serve(e, "/registry/observed", ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	want[1] = ProtectedRoute{Method: http.MethodGet, Path: "/registry/observed", Realm: "registry", Protected: true}
+	if routes := Registry(e); !reflect.DeepEqual(routes, want) {
+		t.Fatalf("routes = %+v, want %+v", routes, want)
+	}
+}
@@ -0,0 +1,152 @@
+package keycloak
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Errors
+var (
+	ErrTokenRevoked       = errors.New("token revoked")
+	ErrRevocationDisabled = errors.New("revocation is disabled")
+)
+
+// Cache key kinds of revocations
+const (
+	cacheKeyRevokedToken   = "revoked-token"
+	cacheKeyRevokedSession = "revoked-session"
+)
+
+// revocations is the in-memory store of revoked token ids and sessions. With a
+// TokenCache, revocations are stored in the cache too, so they are shared by all
+// instances. Unlike caches, it is not emptied by `FlushCaches()` and does not evict
+// revocations before they expire.
+type revocations struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+func newRevocations() *revocations {
+	return &revocations{revoked: make(map[string]time.Time)}
+}
+
+// RevokeToken rejects the token with the jti claim id until expiry, usually the exp
+// claim of the token. It requires Revocation. The revocation applies to this instance
+// even if storing it in the TokenCache fails, which is returned.
+func (v *Verifier) RevokeToken(id string, expiry time.Time) error {
+	return v.revoke(cacheKeyRevokedToken, id, expiry.Sub(v.config.Now()))
+}
+
+// RevokeSession rejects all tokens of the Keycloak session sid (sid or session_state
+// claim) for RevocationTTL, e.g. for an immediate logout. It requires Revocation. The
+// revocation applies to this instance even if storing it in the TokenCache fails,
+// which is returned.
+func (v *Verifier) RevokeSession(sid string) error {
+	return v.revoke(cacheKeyRevokedSession, sid, v.config.RevocationTTL)
+}
+
+// revoke stores the revocation of id of kind for ttl in memory and in the TokenCache.
+func (v *Verifier) revoke(kind, id string, ttl time.Duration) error {
+	config := &v.config
+	if config.revocations == nil {
+		return ErrRevocationDisabled
+	}
+	if id == "" || ttl <= 0 {
+		return nil
+	}
+	r := config.revocations
+	r.mu.Lock()
+	r.revoked[kind+":"+id] = config.Now().Add(ttl)
+	r.mu.Unlock()
+
+	if config.TokenCache == nil {
+		return nil
+	}
+	key := config.cacheKey(kind, id)
+	if cache, ok := config.TokenCache.(CheckedTokenCache); ok {
+		if err := cache.Store(key, []byte{1}, ttl); err != nil {
+			return fmt.Errorf("could not share revocation: %v", err)
+		}
+		return nil
+	}
+	config.TokenCache.Set(key, []byte{1}, ttl)
+	return nil
+}
+
+// revoked reports whether id of kind is revoked in memory.
+func (v *Verifier) revoked(kind, id string) bool {
+	config := &v.config
+	if id == "" {
+		return false
+	}
+	r := config.revocations
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	expiry, ok := r.revoked[kind+":"+id]
+	return ok && config.Now().Before(expiry)
+}
+
+// revokedShared reports whether id of kind is revoked in the TokenCache. Failing
+// lookups are returned as unavailable, so they do not pass as not revoked.
+func (v *Verifier) revokedShared(kind, id string) (bool, error) {
+	config := &v.config
+	if id == "" || config.TokenCache == nil {
+		return false, nil
+	}
+	key := config.cacheKey(kind, id)
+	if cache, ok := config.TokenCache.(CheckedTokenCache); ok {
+		_, ok, err := cache.Lookup(key)
+		if err != nil {
+			return false, &unavailableError{err: fmt.Errorf("could not look up revocation: %v", err)}
+		}
+		return ok, nil
+	}
+	_, ok := config.TokenCache.Get(key)
+	return ok, nil
+}
+
+// verifyRevocation verifies that neither the token of claims nor its session is revoked.
+func (v *Verifier) verifyRevocation(claims jwt.Claims) error {
+	if v.config.revocations == nil {
+		return nil
+	}
+	jti, _ := claimString(claims, "jti")
+	sid, _ := claimString(claims, "sid")
+	if sid == "" {
+		sid, _ = claimString(claims, "session_state")
+	}
+	if v.revoked(cacheKeyRevokedToken, jti) || v.revoked(cacheKeyRevokedSession, sid) {
+		return ErrTokenRevoked
+	}
+	for _, revocation := range [...]struct{ kind, id string }{
+		{cacheKeyRevokedToken, jti},
+		{cacheKeyRevokedSession, sid},
+	} {
+		revoked, err := v.revokedShared(revocation.kind, revocation.id)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return ErrTokenRevoked
+		}
+	}
+	return nil
+}
+
+// sweep removes the revocations expired at now and returns their number.
+func (r *revocations) sweep(now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for id, expiry := range r.revoked {
+		if !now.Before(expiry) {
+			delete(r.revoked, id)
+			n++
+		}
+	}
+	return n
+}
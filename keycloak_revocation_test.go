@@ -0,0 +1,94 @@
+package keycloak
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// failingCache is a CheckedTokenCache whose server is down.
+type failingCache struct{}
+
+var errCacheDown = errors.New("cache down")
+
+func (failingCache) Get(key string) ([]byte, bool)                           { return nil, false }
+func (failingCache) Set(key string, value []byte, ttl time.Duration)         {}
+func (failingCache) Delete(key string)                                       {}
+func (failingCache) Lookup(key string) ([]byte, bool, error)                 { return nil, false, errCacheDown }
+func (failingCache) Store(key string, value []byte, ttl time.Duration) error { return errCacheDown }
+
+func TestRevocation(t *testing.T) {
+	kc := keycloaktest.NewServer("revocation")
+	defer kc.Close()
+
+	tests := map[string]struct {
+		cache TokenCache
+		evict bool
+		flush bool
+	}{
+		"Memory":            {nil, false, false},
+		"MemoryFlushed":     {nil, false, true},
+		"TokenCache":        {NewMemoryCache(10), false, false},
+		"TokenCacheEvicted": {NewMemoryCache(1), true, false},
+		"TokenCacheFlushed": {NewMemoryCache(10), false, true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := testConfig(kc)
+			config.Revocation = true
+			config.TokenCache = test.cache
+			v := NewVerifier(config)
+			defer v.Close()
+
+			token := kc.Token(jwt.MapClaims{"jti": "revoked", "sid": "session"})
+			if _, err := v.ValidateToken(context.Background(), token); err != nil {
+				t.Fatalf("ValidateToken() before revocation = %v", err)
+			}
+			if err := v.RevokeToken("revoked", time.Now().Add(time.Hour)); err != nil {
+				t.Fatalf("RevokeToken() = %v", err)
+			}
+			if test.evict {
+				v.RevokeSession("other")
+			}
+			if test.flush {
+				FlushCaches()
+			}
+			if _, err := v.ValidateToken(context.Background(), token); err != ErrTokenRevoked {
+				t.Errorf("ValidateToken() of revoked token = %v, want %v", err, ErrTokenRevoked)
+			}
+			if _, err := v.ValidateToken(context.Background(), kc.Token(jwt.MapClaims{"sid": "session"})); err != nil {
+				t.Errorf("ValidateToken() of session = %v, want nil", err)
+			}
+			if err := v.RevokeSession("session"); err != nil {
+				t.Fatalf("RevokeSession() = %v", err)
+			}
+			if _, err := v.ValidateToken(context.Background(), kc.Token(jwt.MapClaims{"sid": "session"})); err != ErrTokenRevoked {
+				t.Errorf("ValidateToken() of revoked session = %v, want %v", err, ErrTokenRevoked)
+			}
+		})
+	}
+}
+
+func TestRevocationFailingCache(t *testing.T) {
+	kc := keycloaktest.NewServer("revocation")
+	defer kc.Close()
+	config := testConfig(kc)
+	config.Revocation = true
+	config.TokenCache = failingCache{}
+	v := NewVerifier(config)
+	defer v.Close()
+
+	if _, err := v.ValidateToken(context.Background(), kc.Token(jwt.MapClaims{"sid": "session"})); !isUnavailable(err) {
+		t.Errorf("ValidateToken() with failing cache = %v, want unavailable", err)
+	}
+	if err := v.RevokeSession("session"); err == nil {
+		t.Error("RevokeSession() with failing cache = nil, want error")
+	}
+	if _, err := v.ValidateToken(context.Background(), kc.Token(jwt.MapClaims{"sid": "session"})); err != ErrTokenRevoked {
+		t.Errorf("ValidateToken() of session revoked locally = %v, want %v", err, ErrTokenRevoked)
+	}
+}
@@ -0,0 +1,48 @@
+package keycloak
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// roleTemplate is a role name with placeholders of path parameters, e.g.
+// "org:{org_id}:admin", compiled into the literal parts between the placeholders.
+type roleTemplate struct {
+	literals []string
+	params   []string
+}
+
+// compileRoleTemplate compiles role into a roleTemplate. It returns false if role has
+// no placeholders.
+func compileRoleTemplate(role string) (*roleTemplate, bool) {
+	t := &roleTemplate{}
+	for {
+		start := strings.IndexByte(role, '{')
+		end := strings.IndexByte(role, '}')
+		if start < 0 || end < start {
+			break
+		}
+		t.literals = append(t.literals, role[:start])
+		t.params = append(t.params, role[start+1:end])
+		role = role[end+1:]
+	}
+	t.literals = append(t.literals, role)
+	return t, len(t.params) > 0
+}
+
+// render returns the role with the placeholders replaced by the path parameters of c.
+// It returns false if a path parameter is missing or empty.
+func (t *roleTemplate) render(c echo.Context) (string, bool) {
+	var b strings.Builder
+	for i, param := range t.params {
+		value := c.Param(param)
+		if value == "" {
+			return "", false
+		}
+		b.WriteString(t.literals[i])
+		b.WriteString(value)
+	}
+	b.WriteString(t.literals[len(t.literals)-1])
+	return b.String(), true
+}
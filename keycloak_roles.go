@@ -2,6 +2,7 @@ package keycloak
 
 import (
 	"net/http"
+	"sync/atomic"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/labstack/echo/v4"
@@ -15,6 +16,11 @@ type (
 		// Skipper defines a function to skip middleware.
 		Skipper middleware.Skipper
 
+		// SkipDefaultRoutes additionally skips OPTIONS requests and the paths in
+		// `DefaultSkipPaths` (health, metrics and favicon routes).
+		// Optional. Default value false.
+		SkipDefaultRoutes bool
+
 		// BeforeFunc defines a function which is executed just before the middleware.
 		BeforeFunc middleware.BeforeFunc
 
@@ -28,9 +34,54 @@ type (
 		// ErrorHandlerWithContext is almost identical to ErrorHandler, but it's passed the current context.
 		ErrorHandlerWithContext KeycloakErrorHandlerWithContext
 
-		// KeycloakRoles defines the KeycloakRoles roles having access.
+		// MessageCatalog translates error messages into the language requested by
+		// the Accept-Language header. It is only used if neither ErrorHandler nor
+		// ErrorHandlerWithContext is set.
+		// Optional. See `MapMessageCatalog()`.
+		MessageCatalog KeycloakMessageCatalog
+
+		// ErrorBody defines the response body of errors, e.g. a brand-consistent
+		// JSON envelope. It is only used if neither ErrorHandler nor
+		// ErrorHandlerWithContext is set.
+		// Optional. Default body is {"message": "<error message>"}.
+		ErrorBody KeycloakErrorBodyFunc
+
+		// Negotiate renders errors as JSON, HTML or plain text depending on the
+		// Accept header of the request. It is only used if neither ErrorHandler
+		// nor ErrorHandlerWithContext is set.
+		// Optional.
+		Negotiate *NegotiateConfig
+
+		// KeycloakRoles defines the KeycloakRoles roles having access. Roles may be
+		// templates with placeholders of path parameters, e.g. "org:{org_id}:admin",
+		// which are filled in per request.
+		// Required unless RolesResolver is set.
 		KeycloakRoles []string
 
+		// RolesResolver returns additional roles having access depending on the
+		// request, e.g. "project-" + c.Param("id") + "-admin" for per-resource roles.
+		// Optional.
+		RolesResolver func(c echo.Context) []string
+
+		// MatchMode defines whether the token must have one of KeycloakRoles and the
+		// roles of RolesResolver or all of them.
+		// Optional. Default value MatchAny.
+		MatchMode MatchMode
+
+		// RoleSource defines the claim the roles are taken from.
+		// Optional. Default value RealmRoles.
+		RoleSource RoleSource
+
+		// ClientID defines the client whose roles are used for the ClientRoles and
+		// RealmAndClientRoles role sources.
+		// Required for the ClientRoles and RealmAndClientRoles role sources.
+		ClientID string
+
+		// Principal defines whose roles are checked for tokens of token exchange
+		// chains with an act (actor) claim, see `ActorClaims()`.
+		// Optional. Default value PrincipalSubject.
+		Principal RolePrincipal
+
 		// TokenContextKey is the context key which stores the keycloak jwt token
 		// Optional. Default value "user".
 		TokenContextKey string
@@ -39,6 +90,49 @@ type (
 		// Optional. Default value "roles".
 		RolesContextKey string
 	}
+
+	// RoleSource defines the claim the roles are taken from.
+	RoleSource int
+
+	// RolePrincipal defines whose roles are checked, the subject or the actor of a token.
+	RolePrincipal int
+
+	// MatchMode defines how many of the required roles a token must have.
+	MatchMode int
+)
+
+// Role sources
+const (
+	// RealmRoles are the realm roles of the realm_access claim.
+	RealmRoles RoleSource = iota
+
+	// ClientRoles are the client roles of ClientID of the resource_access claim.
+	ClientRoles
+
+	// RealmAndClientRoles are both the realm roles and the client roles of ClientID.
+	RealmAndClientRoles
+)
+
+// Match modes
+const (
+	// MatchAny requires the token to have at least one of the roles.
+	MatchAny MatchMode = iota
+
+	// MatchAll requires the token to have all of the roles.
+	MatchAll
+)
+
+// Role principals
+const (
+	// PrincipalSubject is the subject of the token, the user the token is issued for.
+	PrincipalSubject RolePrincipal = iota
+
+	// PrincipalActor is the current actor of the act claim, e.g. the service acting
+	// on behalf of the subject. Tokens without act claim are rejected.
+	PrincipalActor
+
+	// PrincipalSubjectAndActor is the union of the roles of the subject and the actor.
+	PrincipalSubjectAndActor
 )
 
 // Errors
@@ -58,7 +152,8 @@ var (
 	}
 )
 
-// KeycloakRoles returns a KeycloakRoles auth middleware.
+// KeycloakRoles returns a KeycloakRoles auth middleware requiring one of roles. See
+// `KeycloakRolesConfig.MatchMode` to require all roles.
 //
 // For valid token, it sets the user in context and calls next handler.
 // For invalid roles, it returns "403 - Forbidden" error.
@@ -76,8 +171,8 @@ func KeycloakRolesWithConfig(config KeycloakRolesConfig) echo.MiddlewareFunc {
 	if config.Skipper == nil {
 		config.Skipper = DefaultKeycloakRolesConfig.Skipper
 	}
-	if len(config.KeycloakRoles) == 0 {
-		panic("echo: keycloak roles middleware requires keycloak roles")
+	if config.SkipDefaultRoutes {
+		config.Skipper = withDefaultRoutes(config.Skipper)
 	}
 	if config.TokenContextKey == "" {
 		config.TokenContextKey = DefaultKeycloakRolesConfig.TokenContextKey
@@ -85,63 +180,170 @@ func KeycloakRolesWithConfig(config KeycloakRolesConfig) echo.MiddlewareFunc {
 	if config.RolesContextKey == "" {
 		config.RolesContextKey = DefaultKeycloakRolesConfig.RolesContextKey
 	}
+	check := newRolesCheck(config)
+
+	id := nextMiddlewareID()
+	register := func(r *ProtectedRoute) {
+		r.Roles = append(r.Roles, config.KeycloakRoles)
+	}
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			if registry.probe(c, id, register) {
+				return next(c)
+			}
 			if config.Skipper(c) {
 				return next(c)
 			}
+			registry.protect(c, id, register)
 
 			if config.BeforeFunc != nil {
 				config.BeforeFunc(c)
 			}
 
-			var err error
 			var roles []string
-			token := c.Get(DefaultKeycloakRolesConfig.TokenContextKey).(*jwt.Token)
-			claims, ok := token.Claims.(*jwt.MapClaims)
-			if !ok || claims == nil {
-				err = ErrClaimsMissing
-			} else {
-				realmAcces, ok := (*claims)["realm_access"].(map[string]interface{})
-				if !ok {
-					err = ErrRealmAccessMissing
-				} else {
-					rolesRaw, ok := realmAcces["roles"].([]interface{})
-					if !ok {
-						err = ErrRolesMissing
-					} else {
-						for _, r := range rolesRaw {
-							roles = append(roles, r.(string))
-						}
-						err = ErrRolesInvalid
-						for _, r := range config.KeycloakRoles {
-							if funk.ContainsString(roles, r) {
-								err = nil
-								break
-							}
-						}
-					}
-				}
+			claims, err := tokenClaims(c, config.TokenContextKey)
+			if err == nil {
+				roles, err = check.check(c, claims)
 			}
-			if err == nil && token.Valid {
-				c.Set(config.RolesContextKey, roles)
+			if err == nil {
+				setRoles(c, config.RolesContextKey, roles)
+				publishEvent(c, DecisionAuthorized, "roles", claims, nil)
 				if config.SuccessHandler != nil {
 					config.SuccessHandler(c)
 				}
 				return next(c)
 			}
+			atomic.AddUint64(&stats.Forbidden, 1)
+			publishEvent(c, DecisionForbidden, "roles", claims, err)
 			if config.ErrorHandler != nil {
 				return config.ErrorHandler(err)
 			}
 			if config.ErrorHandlerWithContext != nil {
 				return config.ErrorHandlerWithContext(err, c)
 			}
-			return &echo.HTTPError{
+			err = &echo.HTTPError{
 				Code:     http.StatusForbidden,
-				Message:  ErrRolesInvalid.Error(),
+				Message:  ErrRolesInvalid.Message,
 				Internal: err,
 			}
+			return respondError(c, err, config.MessageCatalog, config.ErrorBody, config.Negotiate)
+		}
+	}
+}
+
+// rolesCheck checks the roles of tokens like the roles middleware of its config.
+type rolesCheck struct {
+	config    KeycloakRolesConfig
+	required  map[string]struct{}
+	templates []*roleTemplate
+}
+
+func newRolesCheck(config KeycloakRolesConfig) *rolesCheck {
+	if len(config.KeycloakRoles) == 0 && config.RolesResolver == nil {
+		panic("echo: keycloak roles middleware requires keycloak roles")
+	}
+	if config.RoleSource != RealmRoles && config.ClientID == "" {
+		panic("echo: keycloak roles middleware requires client id for client roles")
+	}
+	r := &rolesCheck{config: config, required: make(map[string]struct{}, len(config.KeycloakRoles))}
+	for _, role := range config.KeycloakRoles {
+		if t, ok := compileRoleTemplate(role); ok {
+			r.templates = append(r.templates, t)
+			continue
+		}
+		r.required[role] = struct{}{}
+	}
+	return r
+}
+
+// check returns the roles of claims and ErrRolesInvalid unless they are sufficient
+// for the request of c.
+func (r *rolesCheck) check(c echo.Context, claims jwt.MapClaims) ([]string, error) {
+	roles, err := r.config.principalRoles(c, claims)
+	if err != nil {
+		return roles, err
+	}
+	var resolved []string
+	if r.config.RolesResolver != nil {
+		resolved = r.config.RolesResolver(c)
+	}
+	rendered := true
+	for _, t := range r.templates {
+		if role, ok := t.render(c); ok {
+			resolved = append(resolved, role)
+		} else {
+			rendered = false
+		}
+	}
+	if r.config.MatchMode == MatchAll {
+		if rendered && hasAllRoles(roles, r.required, resolved) {
+			return roles, nil
+		}
+		return roles, ErrRolesInvalid
+	}
+	for _, role := range roles {
+		if _, ok := r.required[role]; ok || funk.ContainsString(resolved, role) {
+			return roles, nil
+		}
+	}
+	return roles, ErrRolesInvalid
+}
+
+// hasAllRoles reports whether roles contain all of required and resolved and at least
+// one role is required.
+func hasAllRoles(roles []string, required map[string]struct{}, resolved []string) bool {
+	if len(required) == 0 && len(resolved) == 0 {
+		return false
+	}
+	for r := range required {
+		if !funk.ContainsString(roles, r) {
+			return false
+		}
+	}
+	for _, r := range resolved {
+		if !funk.ContainsString(roles, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// principalRoles returns the roles of the configured principal of claims.
+func (config *KeycloakRolesConfig) principalRoles(c echo.Context, claims jwt.MapClaims) ([]string, error) {
+	switch config.Principal {
+	case PrincipalActor:
+		actor, ok := ActorClaims(claims)
+		if !ok {
+			return nil, ErrActorMissing
+		}
+		return config.roles(c, actor)
+	case PrincipalSubjectAndActor:
+		roles, err := config.roles(c, claims)
+		if actor, ok := ActorClaims(claims); ok {
+			if actorRoles, actorErr := config.roles(c, actor); actorErr == nil {
+				return append(append(make([]string, 0, len(roles)+len(actorRoles)), roles...), actorRoles...), nil
+			}
+		}
+		return roles, err
+	default:
+		return config.roles(c, claims)
+	}
+}
+
+// roles returns the roles of claims from the configured role source.
+func (config *KeycloakRolesConfig) roles(c echo.Context, claims jwt.MapClaims) ([]string, error) {
+	switch config.RoleSource {
+	case ClientRoles:
+		return extractedClientRoles(c, claims, config.ClientID), nil
+	case RealmAndClientRoles:
+		roles, err := extractedRealmRoles(c, claims)
+		client := extractedClientRoles(c, claims, config.ClientID)
+		if err != nil && len(client) > 0 {
+			return client, nil
 		}
+		return append(append(make([]string, 0, len(roles)+len(client)), roles...), client...), err
+	default:
+		return extractedRealmRoles(c, claims)
 	}
 }
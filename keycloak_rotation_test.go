@@ -0,0 +1,129 @@
+package keycloak
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// withKeyID returns token with its header replaced by a header referencing kid. The
+// signature no longer matches, but the key is looked up before it is verified.
+func withKeyID(token, kid string) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	return base64.RawURLEncoding.EncodeToString(header) + token[strings.Index(token, "."):]
+}
+
+func TestKeyRotationGracePeriod(t *testing.T) {
+	kc := keycloaktest.NewServer("rotation")
+	defer kc.Close()
+	v := NewVerifier(testConfig(kc))
+	defer v.Close()
+	e := testEcho(v.Middleware())
+
+	old := kc.Token(jwt.MapClaims{"sub": "user"})
+	if rec := serve(e, "/", old); rec.Code != http.StatusNoContent {
+		t.Fatalf("token before rotation: unexpected status %d", rec.Code)
+	}
+	fetches := kc.CertRequests()
+
+	kc.RotateKeyGracefully()
+	if rec := serve(e, "/", old); rec.Code != http.StatusNoContent {
+		t.Fatalf("old key id after rotation: unexpected status %d", rec.Code)
+	}
+	if n := kc.CertRequests(); n != fetches {
+		t.Fatalf("old key id after rotation fetched keys %d times", n-fetches)
+	}
+
+	current := kc.Token(jwt.MapClaims{"sub": "user"})
+	if rec := serve(e, "/", current); rec.Code != http.StatusNoContent {
+		t.Fatalf("new key id: unexpected status %d", rec.Code)
+	}
+	if rec := serve(e, "/", old); rec.Code != http.StatusNoContent {
+		t.Fatalf("old key id during grace period: unexpected status %d", rec.Code)
+	}
+	if n := kc.CertRequests(); n != fetches+1 {
+		t.Fatalf("expected 1 key fetch after rotation, got %d", n-fetches)
+	}
+}
+
+func TestKeyRotationRefetchesOnce(t *testing.T) {
+	kc := keycloaktest.NewServer("rotation")
+	defer kc.Close()
+	v := NewVerifier(testConfig(kc))
+	defer v.Close()
+	e := testEcho(v.Middleware())
+
+	if rec := serve(e, "/", kc.Token(jwt.MapClaims{"sub": "user"})); rec.Code != http.StatusNoContent {
+		t.Fatalf("token before rotation: unexpected status %d", rec.Code)
+	}
+	fetches := kc.CertRequests()
+
+	kc.RotateKey()
+	token := kc.Token(jwt.MapClaims{"sub": "user"})
+	var failed uint64
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rec := serve(e, "/", token); rec.Code != http.StatusNoContent {
+				atomic.AddUint64(&failed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if failed > 0 {
+		t.Fatalf("%d requests with the new key id failed", failed)
+	}
+	if n := kc.CertRequests(); n != fetches+1 {
+		t.Fatalf("expected 1 key fetch after rotation, got %d", n-fetches)
+	}
+}
+
+func TestKeyRotationThrottlesUnknownKeyIDs(t *testing.T) {
+	kc := keycloaktest.NewServer("rotation")
+	defer kc.Close()
+	v := NewVerifier(testConfig(kc))
+	defer v.Close()
+	e := testEcho(v.Middleware())
+
+	token := kc.Token(jwt.MapClaims{"sub": "user"})
+	if rec := serve(e, "/", token); rec.Code != http.StatusNoContent {
+		t.Fatalf("valid token: unexpected status %d", rec.Code)
+	}
+	fetches := kc.CertRequests()
+	throttled := Stats().KeyFetchesThrottled
+
+	for _, kid := range []string{"unknown-1", "unknown-2", "unknown-3"} {
+		if rec := serve(e, "/", withKeyID(token, kid)); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("key id %s: unexpected status %d", kid, rec.Code)
+		}
+	}
+	if n := kc.CertRequests(); n != fetches+1 {
+		t.Fatalf("expected 1 key fetch for unknown key ids, got %d", n-fetches)
+	}
+	if n := Stats().KeyFetchesThrottled - throttled; n != 2 {
+		t.Fatalf("expected 2 throttled key fetches, got %d", n)
+	}
+	if rec := serve(e, "/", token); rec.Code != http.StatusNoContent {
+		t.Fatalf("valid token after unknown key ids: unexpected status %d", rec.Code)
+	}
+}
+
+func TestVerifyKeyRotation(t *testing.T) {
+	kc := keycloaktest.NewServer("rotation")
+	defer kc.Close()
+	v := NewVerifier(testConfig(kc))
+	defer v.Close()
+
+	if err := keycloaktest.VerifyKeyRotation(kc, testEcho(v.Middleware()), "/", jwt.MapClaims{"sub": "user"}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,48 @@
+package keycloak
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// KeycloakRouteConfig overrides options of a Keycloak middleware for a route, see
+// `KeycloakRoute()`.
+type KeycloakRouteConfig struct {
+	// RequiredAudience overrides the RequiredAudience of the middleware.
+	// Optional. Default value nil, the RequiredAudience of the middleware is used.
+	RequiredAudience []string
+
+	// Leeway overrides the Leeway of the middleware.
+	// Optional. Default value 0, the Leeway of the middleware is used.
+	Leeway time.Duration
+
+	// OptionalAuth passes requests without token to the next handler, without a
+	// token in context. Requests with an invalid token are still rejected.
+	// Optional. Default value false.
+	OptionalAuth bool
+}
+
+const routeConfigContextKey = "_keycloak_route_config"
+
+// defaultRouteConfig is used for routes without `KeycloakRoute()`.
+var defaultRouteConfig KeycloakRouteConfig
+
+// KeycloakRoute returns the Keycloak middleware keycloak with options overridden by
+// config for the routes it is added to. The caches of keycloak are shared with its
+// other routes, e.g.:
+//
+//	auth := keycloak.KeycloakWithConfig(config)
+//	e.GET("/orders", listOrders, auth)
+//	e.GET("/catalog", listCatalog, keycloak.KeycloakRoute(auth, keycloak.KeycloakRouteConfig{
+//		OptionalAuth: true,
+//	}))
+func KeycloakRoute(keycloak echo.MiddlewareFunc, config KeycloakRouteConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		h := keycloak(next)
+		return func(c echo.Context) error {
+			c.Set(routeConfigContextKey, &config)
+			return h(c)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package keycloak
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/thoas/go-funk"
+)
+
+type (
+	// KeycloakScopesConfig defines the config for the KeycloakScopes middleware.
+	KeycloakScopesConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper middleware.Skipper
+
+		// SkipDefaultRoutes additionally skips OPTIONS requests and the paths in
+		// `DefaultSkipPaths` (health, metrics and favicon routes).
+		// Optional. Default value false.
+		SkipDefaultRoutes bool
+
+		// BeforeFunc defines a function which is executed just before the middleware.
+		BeforeFunc middleware.BeforeFunc
+
+		// SuccessHandler defines a function which is executed for a valid token.
+		SuccessHandler KeycloakSuccessHandler
+
+		// ErrorHandler defines a function which is executed for an invalid token.
+		// It may be used to define a custom KeycloakScopes error.
+		ErrorHandler KeycloakErrorHandler
+
+		// ErrorHandlerWithContext is almost identical to ErrorHandler, but it's passed the current context.
+		ErrorHandlerWithContext KeycloakErrorHandlerWithContext
+
+		// MessageCatalog translates error messages into the language requested by
+		// the Accept-Language header. It is only used if neither ErrorHandler nor
+		// ErrorHandlerWithContext is set.
+		// Optional. See `MapMessageCatalog()`.
+		MessageCatalog KeycloakMessageCatalog
+
+		// ErrorBody defines the response body of errors, e.g. a brand-consistent
+		// JSON envelope. It is only used if neither ErrorHandler nor
+		// ErrorHandlerWithContext is set.
+		// Optional. Default body is {"message": "<error message>"}.
+		ErrorBody KeycloakErrorBodyFunc
+
+		// Negotiate renders errors as JSON, HTML or plain text depending on the
+		// Accept header of the request. It is only used if neither ErrorHandler
+		// nor ErrorHandlerWithContext is set.
+		// Optional.
+		Negotiate *NegotiateConfig
+
+		// KeycloakScopes defines the scopes of the scope claim required, e.g.
+		// "orders:write". The token must have all of them.
+		KeycloakScopes []string
+
+		// TokenContextKey is the context key which stores the keycloak jwt token
+		// Optional. Default value "user".
+		TokenContextKey string
+
+		// ScopesContextKey is the context key which stores the scopes as []string
+		// Optional. Default value "scopes".
+		ScopesContextKey string
+	}
+)
+
+// Errors
+var (
+	ErrScopesInvalid = echo.NewHTTPError(http.StatusForbidden, "invalid scopes")
+)
+
+var (
+	// DefaultKeycloakScopesConfig is the default KeycloakScopes middleware config.
+	DefaultKeycloakScopesConfig = KeycloakScopesConfig{
+		Skipper:          middleware.DefaultSkipper,
+		TokenContextKey:  "user",
+		ScopesContextKey: "scopes",
+	}
+)
+
+// KeycloakScopes returns a KeycloakScopes middleware requiring all of the given scopes.
+//
+// For valid scopes, it sets the scopes in context and calls next handler.
+// For invalid scopes, it returns "403 - Forbidden" error.
+// For missing token in context, it returns "500 - Internal Server Error" error.
+func KeycloakScopes(scopes []string) echo.MiddlewareFunc {
+	c := DefaultKeycloakScopesConfig
+	c.KeycloakScopes = scopes
+	return KeycloakScopesWithConfig(c)
+}
+
+// KeycloakScopesWithConfig returns a KeycloakScopes middleware with config.
+// See: `KeycloakScopes()`.
+func KeycloakScopesWithConfig(config KeycloakScopesConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultKeycloakScopesConfig.Skipper
+	}
+	if config.SkipDefaultRoutes {
+		config.Skipper = withDefaultRoutes(config.Skipper)
+	}
+	if len(config.KeycloakScopes) == 0 {
+		panic("echo: keycloak scopes middleware requires keycloak scopes")
+	}
+	if config.TokenContextKey == "" {
+		config.TokenContextKey = DefaultKeycloakScopesConfig.TokenContextKey
+	}
+	if config.ScopesContextKey == "" {
+		config.ScopesContextKey = DefaultKeycloakScopesConfig.ScopesContextKey
+	}
+
+	id := nextMiddlewareID()
+	register := func(r *ProtectedRoute) {
+		r.Scopes = append(r.Scopes, config.KeycloakScopes)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if registry.probe(c, id, register) {
+				return next(c)
+			}
+			if config.Skipper(c) {
+				return next(c)
+			}
+			registry.protect(c, id, register)
+
+			if config.BeforeFunc != nil {
+				config.BeforeFunc(c)
+			}
+
+			var scopes []string
+			claims, err := tokenClaims(c, config.TokenContextKey)
+			if err == nil {
+				scopes = extractedScopes(c, claims)
+				for _, scope := range config.KeycloakScopes {
+					if !funk.ContainsString(scopes, scope) {
+						err = ErrScopesInvalid
+					}
+				}
+			}
+			if err == nil {
+				c.Set(config.ScopesContextKey, scopes)
+				publishEvent(c, DecisionAuthorized, "scopes", claims, nil)
+				if config.SuccessHandler != nil {
+					config.SuccessHandler(c)
+				}
+				return next(c)
+			}
+			atomic.AddUint64(&stats.Forbidden, 1)
+			publishEvent(c, DecisionForbidden, "scopes", claims, err)
+			if config.ErrorHandler != nil {
+				return config.ErrorHandler(err)
+			}
+			if config.ErrorHandlerWithContext != nil {
+				return config.ErrorHandlerWithContext(err, c)
+			}
+			err = &echo.HTTPError{
+				Code:     http.StatusForbidden,
+				Message:  ErrScopesInvalid.Message,
+				Internal: err,
+			}
+			return respondError(c, err, config.MessageCatalog, config.ErrorBody, config.Negotiate)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package keycloak
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+// SelfTest verifies the given config against the Keycloak server and should be run once
+// at startup to fail fast on misconfiguration. It uses the HTTP client, TLSConfig,
+// ProxyURL, timeouts and endpoints the middleware would use and checks that
+//
+// - the realm exists
+// - the signing keys of the realm are fetchable
+// - the configured client can introspect tokens (only if ClientID is set)
+// - the clock skew to the Keycloak server is below MaxClockSkew
+func SelfTest(ctx context.Context, config KeycloakConfig) error {
+	if config.IssuerURL != "" {
+		config.KeycloakURL, config.BasePath, config.KeycloakRealm = splitIssuerURL(config.IssuerURL)
+		config.DetectBasePath = false
+	}
+	if config.KeycloakURL == "" {
+		return fmt.Errorf("keycloak self-test: missing keycloak url")
+	}
+	if config.MaxClockSkew == 0 {
+		config.MaxClockSkew = config.Leeway + clockSkewResolution
+	}
+	if config.RequestTimeout == 0 {
+		config.RequestTimeout = DefaultKeycloakConfig.RequestTimeout
+	}
+	if config.Logger == nil {
+		config.Logger = log.New("echo-keycloak")
+	}
+	if err := verifyInsecureURL(config.KeycloakURL, config.AllowInsecure, config.Logger); err != nil {
+		return fmt.Errorf("keycloak self-test: %v", err)
+	}
+	if err := verifyInsecureTLS(config.TLSConfig, config.AllowInsecure, config.Logger); err != nil {
+		return fmt.Errorf("keycloak self-test: %v", err)
+	}
+	if config.ProxyURL != "" {
+		if _, err := url.Parse(config.ProxyURL); err != nil {
+			return fmt.Errorf("keycloak self-test: invalid proxy url: %v", err)
+		}
+	}
+	config.gocloakClient = config.newGocloakClient()
+	if config.DetectBasePath {
+		basePath, err := config.detectBasePath()
+		if err != nil {
+			return fmt.Errorf("keycloak self-test: base path: %v", err)
+		}
+		config.BasePath = basePath
+	}
+	if config.IssuerURL != "" {
+		endpoints, err := config.discover()
+		if err != nil {
+			return fmt.Errorf("keycloak self-test: discovery of %s: %v", config.IssuerURL, err)
+		}
+		config.endpoints = endpoints
+	}
+	endpoints := config.oidcEndpoints()
+
+	var realm struct {
+		Realm string `json:"realm"`
+	}
+	resp, err := config.selfTestRequest(ctx, http.MethodGet, realmURL(config), nil, &realm)
+	if err != nil {
+		return fmt.Errorf("keycloak self-test: realm %q: %v", config.KeycloakRealm, err)
+	}
+	if skew := clockSkew(resp, time.Now()); skew > config.MaxClockSkew || skew < -config.MaxClockSkew {
+		return fmt.Errorf("keycloak self-test: clock skew to keycloak of %v exceeds %v", skew, config.MaxClockSkew)
+	}
+
+	var certs struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if _, err := config.selfTestRequest(ctx, http.MethodGet, endpoints.JWKS, nil, &certs); err != nil {
+		return fmt.Errorf("keycloak self-test: keys: %v", err)
+	}
+	if len(certs.Keys) == 0 {
+		return fmt.Errorf("keycloak self-test: realm %q has no signing keys", config.KeycloakRealm)
+	}
+
+	if config.ClientID != "" {
+		auth, err := clientAuthentication(config)
+		if err != nil {
+			return fmt.Errorf("keycloak self-test: client authentication: %v", err)
+		}
+		form := url.Values{"token": {"self-test"}}
+		for k, v := range auth {
+			form.Set(k, v)
+		}
+		var introspection struct {
+			Active bool `json:"active"`
+		}
+		if _, err := config.selfTestRequest(ctx, http.MethodPost, endpoints.Introspection, form, &introspection); err != nil {
+			return fmt.Errorf("keycloak self-test: introspection with client %q: %v", config.ClientID, err)
+		}
+	}
+	return nil
+}
+
+// realmURL returns the URL of the realm of config joined with path.
+func realmURL(config KeycloakConfig, path ...string) string {
+	parts := append([]string{baseURL(config), "realms", config.KeycloakRealm}, path...)
+	return strings.Join(parts, "/")
+}
+
+// adminURL returns the URL of the admin API of the realm of config joined with path.
+func adminURL(config KeycloakConfig, path ...string) string {
+	parts := append([]string{baseURL(config), "admin", "realms", config.KeycloakRealm}, path...)
+	return strings.Join(parts, "/")
+}
+
+// baseURL returns the URL of Keycloak of config including BasePath.
+func baseURL(config KeycloakConfig) string {
+	basePath := config.BasePath
+	if basePath == "" {
+		basePath = defaultBasePath
+	}
+	base := strings.TrimRight(config.KeycloakURL, "/") + "/" + strings.Trim(basePath, "/")
+	return strings.TrimRight(base, "/")
+}
+
+// clockSkew returns the difference of the Date header of resp and now.
+func clockSkew(resp *http.Response, now time.Time) time.Duration {
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0
+	}
+	return date.Sub(now.Truncate(time.Second))
+}
+
+// selfTestRequest sends a request with the form to u with the client of config and
+// decodes the JSON response into result.
+func (config *KeycloakConfig) selfTestRequest(ctx context.Context, method, u string, form url.Values, result interface{}) (*http.Response, error) {
+	req := config.gocloakClient.RestyClient().R().SetContext(ctx)
+	if form != nil {
+		req.SetFormDataFromValues(form)
+	}
+	resp, err := req.Execute(method, u)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return resp.RawResponse, fmt.Errorf("unexpected status %s", resp.Status())
+	}
+	return resp.RawResponse, json.Unmarshal(resp.Body(), result)
+}
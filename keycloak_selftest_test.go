@@ -0,0 +1,65 @@
+package keycloak
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+)
+
+// countingTransport counts the requests sent with it.
+type countingTransport struct {
+	requests uint64
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddUint64(&t.requests, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestSelfTest(t *testing.T) {
+	kc := keycloaktest.NewServer("selftest")
+	defer kc.Close()
+
+	transport := &countingTransport{}
+	config := testConfig(kc)
+	config.HTTPClient = &http.Client{Transport: transport}
+	if err := SelfTest(context.Background(), config); err != nil {
+		t.Fatalf("SelfTest() = %v", err)
+	}
+	if transport.requests != 2 {
+		t.Errorf("SelfTest() sent %d requests with HTTPClient, want 2", transport.requests)
+	}
+
+	config = testConfig(kc)
+	config.KeycloakURL, config.KeycloakRealm = "", ""
+	config.IssuerURL = kc.Issuer()
+	if err := SelfTest(context.Background(), config); err != nil {
+		t.Errorf("SelfTest() with IssuerURL = %v", err)
+	}
+}
+
+func TestSelfTestMisconfiguration(t *testing.T) {
+	kc := keycloaktest.NewServer("selftest")
+	defer kc.Close()
+
+	tests := map[string]func(*KeycloakConfig){
+		"MissingURL":  func(c *KeycloakConfig) { c.KeycloakURL = "" },
+		"InsecureURL": func(c *KeycloakConfig) { c.KeycloakURL = "http://sso.example.com" },
+		"InsecureTLS": func(c *KeycloakConfig) { c.TLSConfig = &tls.Config{InsecureSkipVerify: true} },
+		"ProxyURL":    func(c *KeycloakConfig) { c.ProxyURL = "://proxy" },
+		"Realm":       func(c *KeycloakConfig) { c.KeycloakRealm = "missing" },
+	}
+	for name, misconfigure := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := testConfig(kc)
+			misconfigure(&config)
+			if err := SelfTest(context.Background(), config); err == nil {
+				t.Error("SelfTest() = nil, want error")
+			}
+		})
+	}
+}
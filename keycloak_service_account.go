@@ -0,0 +1,202 @@
+package keycloak
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/thoas/go-funk"
+)
+
+type (
+	// KeycloakServiceAccountsConfig defines the config for the KeycloakServiceAccounts middleware.
+	KeycloakServiceAccountsConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper middleware.Skipper
+
+		// SkipDefaultRoutes additionally skips OPTIONS requests and the paths in
+		// `DefaultSkipPaths` (health, metrics and favicon routes).
+		// Optional. Default value false.
+		SkipDefaultRoutes bool
+
+		// BeforeFunc defines a function which is executed just before the middleware.
+		BeforeFunc middleware.BeforeFunc
+
+		// SuccessHandler defines a function which is executed for a valid token.
+		SuccessHandler KeycloakSuccessHandler
+
+		// ErrorHandler defines a function which is executed for an invalid token.
+		// It may be used to define a custom KeycloakServiceAccounts error.
+		ErrorHandler KeycloakErrorHandler
+
+		// ErrorHandlerWithContext is almost identical to ErrorHandler, but it's passed the current context.
+		ErrorHandlerWithContext KeycloakErrorHandlerWithContext
+
+		// MessageCatalog translates error messages into the language requested by
+		// the Accept-Language header. It is only used if neither ErrorHandler nor
+		// ErrorHandlerWithContext is set.
+		// Optional. See `MapMessageCatalog()`.
+		MessageCatalog KeycloakMessageCatalog
+
+		// ErrorBody defines the response body of errors, e.g. a brand-consistent
+		// JSON envelope. It is only used if neither ErrorHandler nor
+		// ErrorHandlerWithContext is set.
+		// Optional. Default body is {"message": "<error message>"}.
+		ErrorBody KeycloakErrorBodyFunc
+
+		// Negotiate renders errors as JSON, HTML or plain text depending on the
+		// Accept header of the request. It is only used if neither ErrorHandler
+		// nor ErrorHandlerWithContext is set.
+		// Optional.
+		Negotiate *NegotiateConfig
+
+		// Clients defines the client ids whose service accounts have access.
+		// Optional. Default value nil (all clients).
+		Clients []string
+
+		// UsersOnly inverts the middleware for user-facing routes: it accepts only
+		// tokens of users and rejects service-account tokens. Clients is ignored.
+		// Optional. Default value false.
+		UsersOnly bool
+
+		// TokenContextKey is the context key which stores the keycloak jwt token
+		// Optional. Default value "user".
+		TokenContextKey string
+
+		// ClientContextKey is the context key which stores the client id of the
+		// service account as string.
+		// Optional. Default value "client".
+		ClientContextKey string
+	}
+)
+
+// Errors
+var (
+	ErrServiceAccountRequired = echo.NewHTTPError(http.StatusForbidden, "service account required")
+	ErrServiceAccountRejected = echo.NewHTTPError(http.StatusForbidden, "service account not allowed")
+)
+
+var (
+	// DefaultKeycloakServiceAccountsConfig is the default KeycloakServiceAccounts middleware config.
+	DefaultKeycloakServiceAccountsConfig = KeycloakServiceAccountsConfig{
+		Skipper:          middleware.DefaultSkipper,
+		TokenContextKey:  "user",
+		ClientContextKey: "client",
+	}
+)
+
+// KeycloakServiceAccounts returns a KeycloakServiceAccounts middleware for
+// machine-to-machine routes accepting only service-account tokens of clients
+// (client credentials grant), rejecting tokens of interactive users.
+//
+// For service-account tokens, it sets the client id in context and calls next handler.
+// For other tokens, it returns "403 - Forbidden" error.
+// For missing token in context, it returns "500 - Internal Server Error" error.
+func KeycloakServiceAccounts() echo.MiddlewareFunc {
+	return KeycloakServiceAccountsWithConfig(DefaultKeycloakServiceAccountsConfig)
+}
+
+// KeycloakUsers returns a KeycloakServiceAccounts middleware for user-facing routes
+// accepting only tokens of users, rejecting service-account tokens.
+//
+// For user tokens, it calls next handler.
+// For service-account tokens, it returns "403 - Forbidden" error.
+// For missing token in context, it returns "500 - Internal Server Error" error.
+func KeycloakUsers() echo.MiddlewareFunc {
+	c := DefaultKeycloakServiceAccountsConfig
+	c.UsersOnly = true
+	return KeycloakServiceAccountsWithConfig(c)
+}
+
+// KeycloakServiceAccountsWithConfig returns a KeycloakServiceAccounts middleware with config.
+// See: `KeycloakServiceAccounts()`.
+func KeycloakServiceAccountsWithConfig(config KeycloakServiceAccountsConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultKeycloakServiceAccountsConfig.Skipper
+	}
+	if config.SkipDefaultRoutes {
+		config.Skipper = withDefaultRoutes(config.Skipper)
+	}
+	if config.TokenContextKey == "" {
+		config.TokenContextKey = DefaultKeycloakServiceAccountsConfig.TokenContextKey
+	}
+	if config.ClientContextKey == "" {
+		config.ClientContextKey = DefaultKeycloakServiceAccountsConfig.ClientContextKey
+	}
+
+	id := nextMiddlewareID()
+	register := func(r *ProtectedRoute) {
+		r.ServiceAccount = !config.UsersOnly
+		r.UsersOnly = config.UsersOnly
+	}
+	rejected := ErrServiceAccountRequired
+	if config.UsersOnly {
+		rejected = ErrServiceAccountRejected
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if registry.probe(c, id, register) {
+				return next(c)
+			}
+			if config.Skipper(c) {
+				return next(c)
+			}
+			registry.protect(c, id, register)
+
+			if config.BeforeFunc != nil {
+				config.BeforeFunc(c)
+			}
+
+			var client string
+			claims, err := tokenClaims(c, config.TokenContextKey)
+			if err == nil {
+				var ok bool
+				client, ok = serviceAccountClient(claims)
+				switch {
+				case config.UsersOnly:
+					if ok {
+						err = rejected
+					}
+				case !ok || (len(config.Clients) > 0 && !funk.ContainsString(config.Clients, client)):
+					err = rejected
+				}
+			}
+			if err == nil {
+				publishEvent(c, DecisionAuthorized, "service-accounts", claims, nil)
+				if !config.UsersOnly {
+					c.Set(config.ClientContextKey, client)
+				}
+				if config.SuccessHandler != nil {
+					config.SuccessHandler(c)
+				}
+				return next(c)
+			}
+			atomic.AddUint64(&stats.Forbidden, 1)
+			publishEvent(c, DecisionForbidden, "service-accounts", claims, err)
+			if config.ErrorHandler != nil {
+				return config.ErrorHandler(err)
+			}
+			if config.ErrorHandlerWithContext != nil {
+				return config.ErrorHandlerWithContext(err, c)
+			}
+			err = &echo.HTTPError{
+				Code:     http.StatusForbidden,
+				Message:  rejected.Message,
+				Internal: err,
+			}
+			return respondError(c, err, config.MessageCatalog, config.ErrorBody, config.Negotiate)
+		}
+	}
+}
+
+// serviceAccountClient returns the client id of a service-account token, taken from
+// the clientId claim Keycloak issues service-account tokens with. The username is not
+// used, as users may be named like service-account users, "service-account-<client id>".
+func serviceAccountClient(claims jwt.MapClaims) (string, bool) {
+	client, _ := claims["clientId"].(string)
+	return client, client != ""
+}
@@ -0,0 +1,27 @@
+package keycloak
+
+import (
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestServiceAccountClient(t *testing.T) {
+	tests := map[string]struct {
+		claims jwt.MapClaims
+		client string
+		ok     bool
+	}{
+		"ClientID":            {jwt.MapClaims{"clientId": "billing", "preferred_username": "service-account-billing"}, "billing", true},
+		"User":                {jwt.MapClaims{"preferred_username": "alice"}, "", false},
+		"UserNamedLikeClient": {jwt.MapClaims{"preferred_username": "service-account-billing"}, "", false},
+		"EmptyClientID":       {jwt.MapClaims{"clientId": ""}, "", false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if client, ok := serviceAccountClient(test.claims); client != test.client || ok != test.ok {
+				t.Errorf("serviceAccountClient() = %q, %v, want %q, %v", client, ok, test.client, test.ok)
+			}
+		})
+	}
+}
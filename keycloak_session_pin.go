@@ -0,0 +1,168 @@
+package keycloak
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type (
+	// KeycloakSessionPinConfig defines the config for the KeycloakSessionPin middleware.
+	KeycloakSessionPinConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper middleware.Skipper
+
+		// SkipDefaultRoutes additionally skips OPTIONS requests and the paths in
+		// `DefaultSkipPaths` (health, metrics and favicon routes).
+		// Optional. Default value false.
+		SkipDefaultRoutes bool
+
+		// BeforeFunc defines a function which is executed just before the middleware.
+		BeforeFunc middleware.BeforeFunc
+
+		// SuccessHandler defines a function which is executed for a valid token.
+		SuccessHandler KeycloakSuccessHandler
+
+		// ErrorHandler defines a function which is executed for an invalid token.
+		// It may be used to define a custom KeycloakSessionPin error.
+		ErrorHandler KeycloakErrorHandler
+
+		// ErrorHandlerWithContext is almost identical to ErrorHandler, but it's passed the current context.
+		ErrorHandlerWithContext KeycloakErrorHandlerWithContext
+
+		// MessageCatalog translates error messages into the language requested by
+		// the Accept-Language header. It is only used if neither ErrorHandler nor
+		// ErrorHandlerWithContext is set.
+		// Optional. See `MapMessageCatalog()`.
+		MessageCatalog KeycloakMessageCatalog
+
+		// ErrorBody defines the response body of errors, e.g. a brand-consistent
+		// JSON envelope. It is only used if neither ErrorHandler nor
+		// ErrorHandlerWithContext is set.
+		// Optional. Default body is {"message": "<error message>"}.
+		ErrorBody KeycloakErrorBodyFunc
+
+		// Negotiate renders errors as JSON, HTML or plain text depending on the
+		// Accept header of the request. It is only used if neither ErrorHandler
+		// nor ErrorHandlerWithContext is set.
+		// Optional.
+		Negotiate *NegotiateConfig
+
+		// SessionResolver returns the Keycloak session id (sid) of the server-side
+		// session of the request, e.g. stored in the session when the user logged in.
+		// See `SessionFromCookie()`.
+		// Required.
+		SessionResolver func(c echo.Context) (string, error)
+
+		// TokenContextKey is the context key which stores the keycloak jwt token
+		// Optional. Default value "user".
+		TokenContextKey string
+	}
+)
+
+// Errors
+var (
+	ErrSessionMissing  = echo.NewHTTPError(http.StatusUnauthorized, "missing session")
+	ErrSessionMismatch = echo.NewHTTPError(http.StatusUnauthorized, "token does not belong to the session")
+)
+
+var (
+	// DefaultKeycloakSessionPinConfig is the default KeycloakSessionPin middleware config.
+	DefaultKeycloakSessionPinConfig = KeycloakSessionPinConfig{
+		Skipper:         middleware.DefaultSkipper,
+		TokenContextKey: "user",
+	}
+)
+
+// SessionID returns the Keycloak session id of the token in context, see `Claim()`,
+// the sid claim or the session_state claim of older Keycloak versions. It returns
+// false if the token or session id is missing.
+func SessionID(c echo.Context) (string, bool) {
+	claims, err := contextClaims(c)
+	if err != nil {
+		return "", false
+	}
+	return claimsSessionID(claims)
+}
+
+// SessionFromCookie returns a SessionResolver reading the session id from the named
+// cookie.
+func SessionFromCookie(name string) func(c echo.Context) (string, error) {
+	return func(c echo.Context) (string, error) {
+		cookie, err := c.Cookie(name)
+		if err != nil || cookie.Value == "" {
+			return "", ErrSessionMissing
+		}
+		return cookie.Value, nil
+	}
+}
+
+// KeycloakSessionPin returns a KeycloakSessionPin middleware requiring the token to
+// belong to the server-side session of the request returned by resolver, e.g. with
+// tokens of "cookie" lookups, to detect tokens mixed up between sessions.
+//
+// For a token of the session, it calls next handler.
+// For a token of another session or without session id, it returns "401 - Unauthorized" error.
+// For missing token in context, it returns "500 - Internal Server Error" error.
+func KeycloakSessionPin(resolver func(c echo.Context) (string, error)) echo.MiddlewareFunc {
+	c := DefaultKeycloakSessionPinConfig
+	c.SessionResolver = resolver
+	return KeycloakSessionPinWithConfig(c)
+}
+
+// KeycloakSessionPinWithConfig returns a KeycloakSessionPin middleware with config.
+// See: `KeycloakSessionPin()`.
+func KeycloakSessionPinWithConfig(config KeycloakSessionPinConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultKeycloakSessionPinConfig.Skipper
+	}
+	if config.SkipDefaultRoutes {
+		config.Skipper = withDefaultRoutes(config.Skipper)
+	}
+	if config.SessionResolver == nil {
+		panic("echo: keycloak session pin middleware requires session resolver")
+	}
+	if config.TokenContextKey == "" {
+		config.TokenContextKey = DefaultKeycloakSessionPinConfig.TokenContextKey
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			if config.BeforeFunc != nil {
+				config.BeforeFunc(c)
+			}
+
+			claims, err := tokenClaims(c, config.TokenContextKey)
+			if err == nil {
+				var session string
+				if session, err = config.SessionResolver(c); err == nil {
+					if sid, ok := claimsSessionID(claims); !ok || sid != session {
+						err = ErrSessionMismatch
+					}
+				}
+			}
+			if err == nil {
+				if config.SuccessHandler != nil {
+					config.SuccessHandler(c)
+				}
+				return next(c)
+			}
+			atomic.AddUint64(&stats.Unauthorized, 1)
+			publishEvent(c, DecisionUnauthorized, "session-pin", claims, err)
+			if config.ErrorHandler != nil {
+				return config.ErrorHandler(err)
+			}
+			if config.ErrorHandlerWithContext != nil {
+				return config.ErrorHandlerWithContext(err, c)
+			}
+			return respondError(c, err, config.MessageCatalog, config.ErrorBody, config.Negotiate)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package keycloak
+
+import "sync"
+
+type sharedKeys struct {
+	keys *keySet
+	refs int
+}
+
+var (
+	sharedKeySetsMu sync.Mutex
+	sharedKeySets   = make(map[string]*sharedKeys)
+)
+
+// sharedKeySet returns the key set of the certs endpoint jwks shared by the middlewares
+// with SharedKeys. It is created with create by the first middleware and removed when
+// all middlewares called release.
+func sharedKeySet(jwks string, create func() *keySet) (k *keySet, release func()) {
+	sharedKeySetsMu.Lock()
+	defer sharedKeySetsMu.Unlock()
+	shared, ok := sharedKeySets[jwks]
+	if !ok {
+		shared = &sharedKeys{keys: create()}
+		sharedKeySets[jwks] = shared
+	}
+	shared.refs++
+	var once sync.Once
+	return shared.keys, func() {
+		once.Do(func() {
+			sharedKeySetsMu.Lock()
+			defer sharedKeySetsMu.Unlock()
+			if shared.refs--; shared.refs > 0 {
+				return
+			}
+			degradation.remove(shared.keys.degradation)
+			if sharedKeySets[jwks] == shared {
+				delete(sharedKeySets, jwks)
+			}
+		})
+	}
+}
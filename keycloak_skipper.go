@@ -0,0 +1,30 @@
+package keycloak
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/thoas/go-funk"
+)
+
+var (
+	// DefaultSkipPaths are the request paths skipped by `DefaultRoutesSkipper`.
+	DefaultSkipPaths = []string{"/health", "/healthz", "/metrics", "/favicon.ico"}
+)
+
+// DefaultRoutesSkipper skips CORS preflight requests and the paths in `DefaultSkipPaths`.
+func DefaultRoutesSkipper(c echo.Context) bool {
+	if c.Request().Method == http.MethodOptions {
+		return true
+	}
+	return funk.ContainsString(DefaultSkipPaths, c.Request().URL.Path)
+}
+
+// withDefaultRoutes returns a skipper which skips if either the default routes
+// skipper or the given skipper skips.
+func withDefaultRoutes(skipper middleware.Skipper) middleware.Skipper {
+	return func(c echo.Context) bool {
+		return DefaultRoutesSkipper(c) || skipper(c)
+	}
+}
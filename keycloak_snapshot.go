@@ -0,0 +1,60 @@
+package keycloak
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+// snapshotClaims are the claims of a snapshot: the claims of the snapshotted token and
+// the issue and expiry time of the snapshot.
+type snapshotClaims struct {
+	Claims jwt.MapClaims `json:"claims"`
+	jwt.StandardClaims
+}
+
+// Errors
+var (
+	ErrSnapshotInvalid = errors.New("invalid claims snapshot")
+)
+
+// SnapshotClaims returns the claims of the token stored in context under key as compact
+// blob signed with secret (HMAC-SHA256), e.g. to put it on a message queue, so async
+// jobs inherit the identity of the request. The snapshot expires after ttl regardless
+// of the expiry of the token. See `ParseSnapshot()`.
+func SnapshotClaims(c echo.Context, key string, secret []byte, ttl time.Duration) (string, error) {
+	if len(secret) == 0 {
+		panic("echo: keycloak claims snapshot requires secret")
+	}
+	claims, err := tokenClaims(c, key)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	snapshot := jwt.NewWithClaims(jwt.SigningMethodHS256, snapshotClaims{
+		Claims: claims,
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+		},
+	})
+	return snapshot.SignedString(secret)
+}
+
+// ParseSnapshot verifies a snapshot of `SnapshotClaims()` with secret and returns its
+// claims. It returns ErrSnapshotInvalid for invalid signatures and expired snapshots.
+func ParseSnapshot(snapshot string, secret []byte) (jwt.MapClaims, error) {
+	var claims snapshotClaims
+	_, err := jwt.ParseWithClaims(snapshot, &claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, ErrSnapshotInvalid
+		}
+		return secret, nil
+	})
+	if err != nil || claims.Claims == nil {
+		return nil, ErrSnapshotInvalid
+	}
+	return claims.Claims, nil
+}
@@ -0,0 +1,82 @@
+package keycloak
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SilentSSOResult is the result of a silent SSO check posted to the parent window.
+// It is a hint for the UI only, e.g. to start a login, and must not be used for
+// authorization: the callback does not redeem the code, so anyone may load it with
+// forged parameters.
+type SilentSSOResult struct {
+	// Alive reports whether Keycloak issued a code, i.e. the Keycloak SSO session of
+	// the browser is likely alive.
+	Alive bool `json:"alive"`
+
+	// Error is the error returned by Keycloak, e.g. "login_required".
+	Error string `json:"error,omitempty"`
+
+	// State is the state passed to the check endpoint. It must be compared with
+	// the state the check was started with.
+	State string `json:"state,omitempty"`
+}
+
+var silentSSOTemplate = template.Must(template.New("sso").Parse(
+	`<!DOCTYPE html><html><body><script>parent.postMessage({{.}}, location.origin);</script></body></html>`))
+
+// KeycloakSilentSSO registers the endpoints of a silent SSO check on g, which
+// reports whether the Keycloak SSO session of a browser is still alive without
+// user interaction, e.g. for SPAs loading the check endpoint in a hidden iframe:
+//
+// - GET /auth/sso/check?state=<state> redirects to the Keycloak authorization
+// endpoint with prompt=none
+// - GET /auth/sso/callback posts a SilentSSOResult to the parent window
+//
+// callbackURL is the absolute public URL of the callback endpoint, e.g.
+// "https://app.example.com/auth/sso/callback", and must be a valid redirect URI of the
+// client. It is configured explicitly, as the Host header of requests may be forged.
+// The authorization endpoint and ClientID of verifier are used. See `SilentSSOResult`
+// for what the result may be used for.
+func KeycloakSilentSSO(g *echo.Group, verifier *Verifier, callbackURL string) {
+	config := &verifier.config
+	if config.KeycloakURL == "" {
+		panic("echo: keycloak silent sso requires keycloak url")
+	}
+	if config.ClientID == "" {
+		panic("echo: keycloak silent sso requires client id")
+	}
+	if u, err := url.Parse(callbackURL); err != nil || !u.IsAbs() || u.Host == "" {
+		panic("echo: keycloak silent sso requires an absolute callback url")
+	}
+	authURL := config.oidcEndpoints().Authorization
+
+	g.GET("/auth/sso/check", func(c echo.Context) error {
+		query := url.Values{
+			"client_id":     {config.ClientID},
+			"redirect_uri":  {callbackURL},
+			"response_type": {"code"},
+			"scope":         {"openid"},
+			"prompt":        {"none"},
+		}
+		if state := c.QueryParam("state"); state != "" {
+			query.Set("state", state)
+		}
+		return c.Redirect(http.StatusFound, authURL+"?"+query.Encode())
+	})
+
+	g.GET("/auth/sso/callback", func(c echo.Context) error {
+		result := SilentSSOResult{
+			Error: c.QueryParam("error"),
+			State: c.QueryParam("state"),
+		}
+		result.Alive = result.Error == "" && c.QueryParam("code") != ""
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+		c.Response().Header().Set(headerCacheControl, "no-store")
+		c.Response().WriteHeader(http.StatusOK)
+		return silentSSOTemplate.Execute(c.Response(), result)
+	})
+}
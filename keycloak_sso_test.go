@@ -0,0 +1,48 @@
+package keycloak
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/labstack/echo/v4"
+)
+
+func TestKeycloakSilentSSOCallbackURL(t *testing.T) {
+	kc := keycloaktest.NewServer("sso")
+	defer kc.Close()
+	config := testConfig(kc)
+	config.ClientID = "web"
+	v := NewVerifier(config)
+	defer v.Close()
+
+	for _, callback := range []string{"", "/auth/sso/callback", "app.example.com/auth/sso/callback"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("KeycloakSilentSSO() with callback url %q did not panic", callback)
+				}
+			}()
+			KeycloakSilentSSO(echo.New().Group(""), v, callback)
+		}()
+	}
+
+	e := echo.New()
+	KeycloakSilentSSO(e.Group(""), v, "https://app.example.com/auth/sso/callback")
+	req := httptest.NewRequest(http.MethodGet, "/auth/sso/check?state=xyz", nil)
+	req.Host = "evil.example.com"
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	location, err := url.Parse(rec.Header().Get(echo.HeaderLocation))
+	if rec.Code != http.StatusFound || err != nil {
+		t.Fatalf("status = %d, location error %v", rec.Code, err)
+	}
+	if redirect := location.Query().Get("redirect_uri"); redirect != "https://app.example.com/auth/sso/callback" {
+		t.Errorf("redirect_uri = %q, want the configured callback url", redirect)
+	}
+	if state := location.Query().Get("state"); state != "xyz" {
+		t.Errorf("state = %q, want %q", state, "xyz")
+	}
+}
@@ -0,0 +1,26 @@
+package keycloak
+
+import "github.com/labstack/echo/v4"
+
+// Stack returns the Keycloak middleware of config followed by a KeycloakRoles middleware
+// for each of rolesConfigs, in the order they must be executed, e.g.
+//
+//	e.GET("/admin", handler, keycloak.Stack(config, keycloak.KeycloakRolesConfig{
+//		KeycloakRoles: []string{"admin"},
+//	})...)
+//
+// Roles configs without TokenContextKey use the ContextKey of config.
+func Stack(config KeycloakConfig, rolesConfigs ...KeycloakRolesConfig) []echo.MiddlewareFunc {
+	if config.ContextKey == "" {
+		config.ContextKey = DefaultKeycloakConfig.ContextKey
+	}
+	stack := make([]echo.MiddlewareFunc, 0, 1+len(rolesConfigs))
+	stack = append(stack, KeycloakWithConfig(config))
+	for _, rolesConfig := range rolesConfigs {
+		if rolesConfig.TokenContextKey == "" {
+			rolesConfig.TokenContextKey = config.ContextKey
+		}
+		stack = append(stack, KeycloakRolesWithConfig(rolesConfig))
+	}
+	return stack
+}
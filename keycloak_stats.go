@@ -0,0 +1,99 @@
+package keycloak
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	// Statistics contains the counters of all middlewares of this package.
+	Statistics struct {
+		// Authorized is the number of requests with a valid token.
+		Authorized uint64 `json:"authorized"`
+
+		// Unauthorized is the number of requests with a missing or invalid token.
+		Unauthorized uint64 `json:"unauthorized"`
+
+		// Forbidden is the number of requests denied by a roles middleware.
+		Forbidden uint64 `json:"forbidden"`
+
+		// ClockSkewWarnings is the number of Keycloak responses with a clock skew
+		// exceeding the configured MaxClockSkew.
+		ClockSkewWarnings uint64 `json:"clockSkewWarnings"`
+
+		// CacheFlushes is the number of cache flushes.
+		CacheFlushes uint64 `json:"cacheFlushes"`
+
+		// KeyFetches is the number of fetches of the public keys of realms.
+		KeyFetches uint64 `json:"keyFetches"`
+
+		// KeyFetchesThrottled is the number of fetches of public keys skipped within
+		// KeyRefetchInterval of the previous fetch.
+		KeyFetchesThrottled uint64 `json:"keyFetchesThrottled"`
+
+		// EventsDropped is the number of auth events dropped for slow subscribers,
+		// see `SubscribeEvents()`.
+		EventsDropped uint64 `json:"eventsDropped"`
+
+		// Sweeps is the number of sweeps of expired sessions and cache entries, see
+		// `KeycloakConfig.SweepInterval`.
+		Sweeps uint64 `json:"sweeps"`
+
+		// SweptEntries is the number of expired sessions and cache entries removed by
+		// sweeps.
+		SweptEntries uint64 `json:"sweptEntries"`
+
+		// Degradation is the current degradation state, see `Degradation()`.
+		Degradation DegradationReport `json:"degradation"`
+	}
+)
+
+var (
+	stats Statistics
+
+	cacheFlushersMu sync.Mutex
+	cacheFlushers   = make(map[uint64]func())
+	cacheFlusherIDs uint64
+)
+
+// Stats returns the current counters of all middlewares of this package.
+func Stats() Statistics {
+	return Statistics{
+		Authorized:          atomic.LoadUint64(&stats.Authorized),
+		Unauthorized:        atomic.LoadUint64(&stats.Unauthorized),
+		Forbidden:           atomic.LoadUint64(&stats.Forbidden),
+		ClockSkewWarnings:   atomic.LoadUint64(&stats.ClockSkewWarnings),
+		CacheFlushes:        atomic.LoadUint64(&stats.CacheFlushes),
+		KeyFetches:          atomic.LoadUint64(&stats.KeyFetches),
+		KeyFetchesThrottled: atomic.LoadUint64(&stats.KeyFetchesThrottled),
+		EventsDropped:       atomic.LoadUint64(&stats.EventsDropped),
+		Sweeps:              atomic.LoadUint64(&stats.Sweeps),
+		SweptEntries:        atomic.LoadUint64(&stats.SweptEntries),
+		Degradation:         Degradation(),
+	}
+}
+
+// FlushCaches empties the caches of all middlewares of this package.
+func FlushCaches() {
+	cacheFlushersMu.Lock()
+	defer cacheFlushersMu.Unlock()
+	for _, flush := range cacheFlushers {
+		flush()
+	}
+	atomic.AddUint64(&stats.CacheFlushes, 1)
+}
+
+// registerCacheFlusher registers a function emptying caches for `FlushCaches()` and
+// returns a function removing it again.
+func registerCacheFlusher(flush func()) (unregister func()) {
+	cacheFlushersMu.Lock()
+	defer cacheFlushersMu.Unlock()
+	cacheFlusherIDs++
+	id := cacheFlusherIDs
+	cacheFlushers[id] = flush
+	return func() {
+		cacheFlushersMu.Lock()
+		defer cacheFlushersMu.Unlock()
+		delete(cacheFlushers, id)
+	}
+}
@@ -0,0 +1,113 @@
+package keycloak
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// StatsDConfig defines the config of the StatsD exporter of `Stats()`.
+	StatsDConfig struct {
+		// Addr is the UDP address of the StatsD server or Datadog agent, e.g. "localhost:8125".
+		Addr string
+
+		// Prefix is prepended to the metric names.
+		// Optional. Default value "echo_keycloak.".
+		Prefix string
+
+		// Tags are appended to all metrics in the Datadog format, e.g. "env:prod".
+		// Optional.
+		Tags []string
+
+		// Interval is the interval the metrics are sent.
+		// Optional. Default value 10 seconds.
+		Interval time.Duration
+	}
+)
+
+var (
+	// DefaultStatsDConfig is the default StatsD exporter config.
+	DefaultStatsDConfig = StatsDConfig{
+		Prefix:   "echo_keycloak.",
+		Interval: 10 * time.Second,
+	}
+)
+
+// ExportStatsD sends the counters of `Stats()` to a StatsD server every Interval until
+// `Close()` is called, e.g. for teams without Prometheus. Counters are sent as the
+// increase since the last interval and the degradation as gauge "degraded".
+func ExportStatsD(config StatsDConfig) error {
+	if config.Addr == "" {
+		panic("echo: keycloak statsd exporter requires addr")
+	}
+	if config.Prefix == "" {
+		config.Prefix = DefaultStatsDConfig.Prefix
+	}
+	if config.Interval == 0 {
+		config.Interval = DefaultStatsDConfig.Interval
+	}
+	conn, err := net.Dial("udp", config.Addr)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(config.Interval)
+	stop := make(chan struct{})
+	var once sync.Once
+	registerCloser(func() {
+		once.Do(func() { close(stop) })
+	})
+	last := Stats()
+	go func() {
+		defer conn.Close()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				current := Stats()
+				conn.Write(config.metrics(last, current))
+				last = current
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// metrics returns the StatsD lines of the increase of the counters from last to current.
+func (config *StatsDConfig) metrics(last, current Statistics) []byte {
+	var tags string
+	if len(config.Tags) > 0 {
+		tags = "|#" + strings.Join(config.Tags, ",")
+	}
+	var b bytes.Buffer
+	write := func(name string, value uint64, kind string) {
+		b.WriteString(config.Prefix)
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(strconv.FormatUint(value, 10))
+		b.WriteByte('|')
+		b.WriteString(kind)
+		b.WriteString(tags)
+		b.WriteByte('\n')
+	}
+	write("authorized", current.Authorized-last.Authorized, "c")
+	write("unauthorized", current.Unauthorized-last.Unauthorized, "c")
+	write("forbidden", current.Forbidden-last.Forbidden, "c")
+	write("clock_skew_warnings", current.ClockSkewWarnings-last.ClockSkewWarnings, "c")
+	write("cache_flushes", current.CacheFlushes-last.CacheFlushes, "c")
+	write("key_fetches", current.KeyFetches-last.KeyFetches, "c")
+	write("key_fetches_throttled", current.KeyFetchesThrottled-last.KeyFetchesThrottled, "c")
+	write("swept_entries", current.SweptEntries-last.SweptEntries, "c")
+	var degraded uint64
+	if current.Degradation.Degraded {
+		degraded = 1
+	}
+	write("degraded", degraded, "g")
+	return b.Bytes()
+}
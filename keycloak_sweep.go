@@ -0,0 +1,59 @@
+package keycloak
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// sweepEvery removes the expired entries of the in-memory stores of the verifier every
+// interval until the verifier is closed.
+func (v *Verifier) sweepEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				v.sweep()
+			case <-v.stop:
+				return
+			}
+		}
+	}()
+}
+
+// sweep removes the expired entries of the in-memory stores of the verifier.
+func (v *Verifier) sweep() {
+	config := &v.config
+	now := config.Now()
+	n := 0
+	if config.userInfoMemo != nil {
+		n += config.userInfoMemo.sweep(now)
+	}
+	if config.enrichmentMemo != nil {
+		n += config.enrichmentMemo.sweep(now)
+	}
+	if config.activeSessions != nil {
+		n += config.activeSessions.sweep(now)
+	}
+	if config.sessionClaims != nil {
+		n += config.sessionClaims.sweep(now)
+	}
+	if config.usedTokens != nil {
+		n += config.usedTokens.sweep(now)
+	}
+	if config.revocations != nil {
+		n += config.revocations.sweep(now)
+	}
+	if config.validationCache != nil {
+		n += config.validationCache.sweep(now)
+	}
+	if config.introspectionCache != nil {
+		n += config.introspectionCache.sweep(now)
+	}
+	atomic.AddUint64(&stats.Sweeps, 1)
+	atomic.AddUint64(&stats.SweptEntries, uint64(n))
+	if n > 0 {
+		config.Logger.Debugf("swept %d expired entries of realm %s", n, config.KeycloakRealm)
+	}
+}
@@ -0,0 +1,113 @@
+package keycloak
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// testConfig returns the default config for the realm of the mock server kc, logging
+// nothing.
+func testConfig(kc *keycloaktest.Server) KeycloakConfig {
+	logger := log.New("echo-keycloak")
+	logger.SetOutput(ioutil.Discard)
+	config := DefaultKeycloakConfig
+	config.KeycloakURL = kc.URL
+	config.KeycloakRealm = kc.Realm
+	config.Logger = logger
+	return config
+}
+
+// testEcho returns an echo instance serving "204 - No Content" at "/" behind middlewares.
+func testEcho(middlewares ...echo.MiddlewareFunc) *echo.Echo {
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, middlewares...)
+	return e
+}
+
+// serve sends a GET request of path with the bearer token to handler.
+func serve(handler http.Handler, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTokenFromBodyLimit(t *testing.T) {
+	extract := tokenFromBody("token", 64)
+	for _, test := range []struct {
+		body  string
+		token string
+		err   error
+	}{
+		{`{"token":"abc"}`, "abc", nil},
+		{`{"token":"` + strings.Repeat("a", 64) + `"}`, "", ErrTokenBodyTooLarge},
+		{`{}`, "", ErrTokenMissing},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+		c := echo.New().NewContext(req, httptest.NewRecorder())
+		token, err := extract(c)
+		if token != test.token || err != test.err {
+			t.Errorf("body %s: got token %q and error %v, want %q and %v", test.body, token, err, test.token, test.err)
+		}
+	}
+}
+
+func TestTokenFromSignedCookie(t *testing.T) {
+	secret := []byte("cookie-secret")
+	sign := func(value string, secret []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(value))
+		return mac.Sum(nil)
+	}
+	base64url := func(value string) string { return base64.RawURLEncoding.EncodeToString(sign(value, secret)) }
+
+	extract := tokenFromSignedCookie("access|token", ".sig", secret)
+	tests := map[string]struct {
+		cookies map[string]string
+		token   string
+		err     error
+	}{
+		"Base64URL":       {map[string]string{"access": "abc", "access.sig": base64url("abc")}, "abc", nil},
+		"Base64URLPadded": {map[string]string{"access": "abc", "access.sig": base64.URLEncoding.EncodeToString(sign("abc", secret))}, "abc", nil},
+		"Hex":             {map[string]string{"access": "abc", "access.sig": hex.EncodeToString(sign("abc", secret))}, "abc", nil},
+		"SecondCookie":    {map[string]string{"token": "abc", "token.sig": base64url("abc")}, "abc", nil},
+		"OtherSecret":     {map[string]string{"access": "abc", "access.sig": base64.RawURLEncoding.EncodeToString(sign("abc", []byte("other")))}, "", ErrCookieSignatureInvalid},
+		"TamperedToken":   {map[string]string{"access": "abd", "access.sig": base64url("abc")}, "", ErrCookieSignatureInvalid},
+		"SignatureOfName": {map[string]string{"token": "abc", "token.sig": base64url("token")}, "", ErrCookieSignatureInvalid},
+		"Truncated":       {map[string]string{"access": "abc", "access.sig": base64url("abc")[:20]}, "", ErrCookieSignatureInvalid},
+		"Garbage":         {map[string]string{"access": "abc", "access.sig": "!!"}, "", ErrCookieSignatureInvalid},
+		"MissingSig":      {map[string]string{"access": "abc"}, "", ErrCookieSignatureInvalid},
+		"OtherCookieSig":  {map[string]string{"access": "abc", "token.sig": base64url("abc")}, "", ErrCookieSignatureInvalid},
+		"InvalidFirst":    {map[string]string{"access": "abc", "token": "abc", "token.sig": base64url("abc")}, "", ErrCookieSignatureInvalid},
+		"Missing":         {map[string]string{"access.sig": base64url("")}, "", ErrTokenMissing},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for name, value := range test.cookies {
+				req.AddCookie(&http.Cookie{Name: name, Value: value})
+			}
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+			token, err := extract(c)
+			if token != test.token || err != test.err {
+				t.Errorf("tokenFromSignedCookie() = %q, %v, want %q, %v", token, err, test.token, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package keycloak
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Errors
+var (
+	ErrKeyNotFound = errors.New("cannot find a key to decode the token")
+)
+
+// timeClaims are claims with time claims, e.g. jwt.MapClaims or claims embedding jwt.StandardClaims.
+type timeClaims interface {
+	VerifyExpiresAt(cmp int64, req bool) bool
+	VerifyIssuedAt(cmp int64, req bool) bool
+	VerifyNotBefore(cmp int64, req bool) bool
+}
+
+// decoderClaims decodes the claims of a token parsed by jwt-go with ClaimsDecoder.
+type decoderClaims struct {
+	jwt.Claims
+	decode func(data []byte, v interface{}) error
+}
+
+// UnmarshalJSON decodes data into the wrapped claims with the decoder.
+func (c *decoderClaims) UnmarshalJSON(data []byte) error {
+	if m, ok := c.Claims.(jwt.MapClaims); ok {
+		return c.decode(data, &m)
+	}
+	return c.decode(data, c.Claims)
+}
+
+// decodeToken parses auth with jwt-go, verifying its signature with the keys of the realm
+// if verify is set, decodes it into claims with the ClaimsDecoder and validates the time
+// claims against Now with leeway. Fetching keys is cancelled with ctx.
+func (config *KeycloakConfig) decodeToken(ctx context.Context, auth string, claims jwt.Claims, verify bool, leeway time.Duration) (*jwt.Token, error) {
+	parser := &jwt.Parser{ValidMethods: config.AllowedAlgorithms, SkipClaimsValidation: true}
+	decoder := &decoderClaims{Claims: claims, decode: config.ClaimsDecoder}
+	var token *jwt.Token
+	var err error
+	if verify {
+		token, err = parser.ParseWithClaims(auth, decoder, func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return config.keySet.key(ctx, kid)
+		})
+	} else if token, _, err = parser.ParseUnverified(auth, decoder); err == nil {
+		if _, ok := config.allowedAlgorithms[token.Method.Alg()]; !ok {
+			err = jwt.NewValidationError(fmt.Sprintf("signing method %v is invalid", token.Method.Alg()), jwt.ValidationErrorSignatureInvalid)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	token.Claims = claims
+	token.Valid = true
+
+	if err := validateTimeClaims(claims, config.Now(), leeway); err != nil {
+		token.Valid = false
+		return token, err
+	}
+	return token, nil
+}
+
+// validateTimeClaims validates the exp, iat and nbf claims against now, tolerating a
+// clock difference of leeway. Claims without time claims are validated with their
+// Valid method.
+func validateTimeClaims(claims jwt.Claims, now time.Time, leeway time.Duration) error {
+	c, ok := claims.(timeClaims)
+	if !ok {
+		return claims.Valid()
+	}
+	verr := new(jwt.ValidationError)
+	if !c.VerifyExpiresAt(now.Add(-leeway).Unix(), false) {
+		verr.Inner = errors.New("token is expired")
+		verr.Errors |= jwt.ValidationErrorExpired
+	}
+	if !c.VerifyIssuedAt(now.Add(leeway).Unix(), false) {
+		verr.Inner = errors.New("token used before issued")
+		verr.Errors |= jwt.ValidationErrorIssuedAt
+	}
+	if !c.VerifyNotBefore(now.Add(leeway).Unix(), false) {
+		verr.Inner = errors.New("token is not valid yet")
+		verr.Errors |= jwt.ValidationErrorNotValidYet
+	}
+	if verr.Errors != 0 {
+		return verr
+	}
+	return nil
+}
+
+// publicKey returns the public key of a JSON web key of the realm, an *rsa.PublicKey
+// for RSA keys and an *ecdsa.PublicKey for EC keys.
+func publicKey(key jsonWebKey) (crypto.PublicKey, error) {
+	switch key.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, err
+		}
+		if len(n) == 0 || len(e) == 0 {
+			return nil, ErrKeyNotFound
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch key.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, ErrKeyNotFound
+		}
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	}
+	return nil, ErrKeyNotFound
+}
+
+// supportedAlgorithm reports whether alg is an asymmetric signing algorithm supported
+// for realm keys: RS*, PS* and ES*.
+func supportedAlgorithm(alg string) bool {
+	switch jwt.GetSigningMethod(alg).(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package keycloak
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestDecodeTokenNow(t *testing.T) {
+	kc := keycloaktest.NewServer("token")
+	defer kc.Close()
+	now := time.Now().Add(-time.Hour)
+	config := testConfig(kc)
+	config.Now = func() time.Time { return now }
+	config.Leeway = time.Minute
+	v := NewVerifier(config)
+	defer v.Close()
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		valid  bool
+	}{
+		{"valid at now", jwt.MapClaims{"iat": now.Add(-time.Minute).Unix(), "exp": now.Add(time.Minute).Unix()}, true},
+		{"expired at now", jwt.MapClaims{"iat": now.Add(-time.Hour).Unix(), "exp": now.Add(-2 * time.Minute).Unix()}, false},
+		{"expired within leeway", jwt.MapClaims{"iat": now.Add(-time.Hour).Unix(), "exp": now.Add(-30 * time.Second).Unix()}, true},
+		{"issued after now", jwt.MapClaims{"iat": now.Add(2 * time.Minute).Unix(), "exp": now.Add(time.Hour).Unix()}, false},
+		{"not valid yet", jwt.MapClaims{"iat": now.Unix(), "nbf": now.Add(2 * time.Minute).Unix(), "exp": now.Add(time.Hour).Unix()}, false},
+	}
+	for _, test := range tests {
+		_, err := v.ValidateToken(context.Background(), kc.Token(test.claims))
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%s: got error %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestDecodeTokenRejectsUnverifiedTokens(t *testing.T) {
+	kc := keycloaktest.NewServer("token")
+	defer kc.Close()
+	v := NewVerifier(testConfig(kc))
+	defer v.Close()
+	token := kc.Token(jwt.MapClaims{"sub": "user"})
+	if _, err := v.ValidateToken(context.Background(), token); err != nil {
+		t.Fatalf("valid token: unexpected error %v", err)
+	}
+
+	claims := jwt.MapClaims{"sub": "admin", "typ": TokenTypeBearer, "exp": time.Now().Add(time.Hour).Unix()}
+	none, _ := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	hmac.Header["kid"] = kc.KeyID()
+	hs256, _ := hmac.SignedString([]byte("secret"))
+	parts := strings.Split(token, ".")
+	payload, _ := json.Marshal(claims)
+	tampered := parts[0] + "." + jwt.EncodeSegment(payload) + "." + parts[2]
+
+	for name, token := range map[string]string{
+		"alg none":        none,
+		"alg HS256":       hs256,
+		"tampered claims": tampered,
+		"malformed":       "a.b",
+	} {
+		if _, err := v.ValidateToken(context.Background(), token); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
+
+func TestDecodeTokenClaimsDecoder(t *testing.T) {
+	kc := keycloaktest.NewServer("token")
+	defer kc.Close()
+	decoded := 0
+	config := testConfig(kc)
+	config.ClaimsDecoder = func(data []byte, v interface{}) error {
+		decoded++
+		return json.Unmarshal(data, v)
+	}
+	v := NewVerifier(config)
+	defer v.Close()
+
+	token, err := v.ValidateToken(context.Background(), kc.Token(jwt.MapClaims{"sub": "user"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != 1 {
+		t.Fatalf("expected 1 decoded token, got %d", decoded)
+	}
+	if claims, ok := mapClaims(token); !ok || claims["sub"] != "user" {
+		t.Fatalf("unexpected claims %v", token.Claims)
+	}
+}
+
+func TestDecodeTokenIgnoresSharedCache(t *testing.T) {
+	kc := keycloaktest.NewServer("token")
+	defer kc.Close()
+	cache := NewMemoryCache(10)
+	config := testConfig(kc)
+	config.TokenCache = cache
+	v := NewVerifier(config)
+	defer v.Close()
+
+	token := kc.Token(jwt.MapClaims{"sub": "user"})
+	parts := strings.Split(token, ".")
+	payload, _ := json.Marshal(jwt.MapClaims{"sub": "admin", "typ": TokenTypeBearer, "exp": time.Now().Add(time.Hour).Unix()})
+	forged := parts[0] + "." + jwt.EncodeSegment(payload) + "." + parts[2]
+	// an entry of the shared cache must never skip the verification of signatures
+	cache.Set(v.config.cacheKey("verified", forged), []byte{1}, time.Hour)
+
+	if _, err := v.ValidateToken(context.Background(), forged); err == nil {
+		t.Error("forged token accepted")
+	}
+	if _, err := v.ValidateToken(context.Background(), token); err != nil {
+		t.Errorf("valid token: unexpected error %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package keycloak
+
+import (
+	"errors"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/thoas/go-funk"
+)
+
+// Token types of the typ claim of Keycloak tokens
+const (
+	TokenTypeBearer  = "Bearer"
+	TokenTypeRefresh = "Refresh"
+	TokenTypeOffline = "Offline"
+	TokenTypeID      = "ID"
+)
+
+// Errors
+var (
+	ErrTokenTypeInvalid = errors.New("token is not an access token")
+)
+
+// verifyTokenType verifies that the typ claim of claims is one of types, e.g. to
+// reject refresh and ID tokens presented as access tokens. Claims without a typ claim
+// are rejected unless allowMissing is set.
+func verifyTokenType(claims jwt.Claims, types []string, allowMissing bool) error {
+	typ, ok := claimString(claims, "typ")
+	if !ok {
+		if allowMissing {
+			return nil
+		}
+		return ErrTokenTypeInvalid
+	}
+	if !funk.ContainsString(types, typ) {
+		return ErrTokenTypeInvalid
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package keycloak
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestVerifyTokenType(t *testing.T) {
+	types := []string{TokenTypeBearer}
+	tests := []struct {
+		claims       jwt.Claims
+		allowMissing bool
+		err          error
+	}{
+		{jwt.MapClaims{"typ": TokenTypeBearer}, false, nil},
+		{jwt.MapClaims{"typ": TokenTypeRefresh}, false, ErrTokenTypeInvalid},
+		{jwt.MapClaims{"typ": TokenTypeID}, false, ErrTokenTypeInvalid},
+		{jwt.MapClaims{"sub": "user"}, false, ErrTokenTypeInvalid},
+		{&jwt.MapClaims{}, false, ErrTokenTypeInvalid},
+		{&jwt.StandardClaims{Subject: "user"}, false, ErrTokenTypeInvalid},
+		{jwt.MapClaims{"typ": TokenTypeBearer}, true, nil},
+		{jwt.MapClaims{"typ": TokenTypeRefresh}, true, ErrTokenTypeInvalid},
+		{jwt.MapClaims{"sub": "user"}, true, nil},
+		{&jwt.StandardClaims{Subject: "user"}, true, nil},
+	}
+	for i, test := range tests {
+		if err := verifyTokenType(test.claims, types, test.allowMissing); err != test.err {
+			t.Errorf("%d: verifyTokenType() = %v, want %v", i, err, test.err)
+		}
+	}
+}
+
+func TestAllowMissingTokenType(t *testing.T) {
+	kc := keycloaktest.NewServer("typ")
+	defer kc.Close()
+	token := kc.Token(jwt.MapClaims{"typ": nil})
+
+	tests := []struct {
+		allowMissing bool
+		status       int
+	}{
+		{false, http.StatusUnauthorized},
+		{true, http.StatusNoContent},
+	}
+	for _, test := range tests {
+		config := testConfig(kc)
+		config.AllowMissingTokenType = test.allowMissing
+		if rec := serve(testEcho(KeycloakWithConfig(config)), "/", token); rec.Code != test.status {
+			t.Errorf("AllowMissingTokenType %v: status %d, want %d", test.allowMissing, rec.Code, test.status)
+		}
+	}
+}
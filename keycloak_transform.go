@@ -0,0 +1,68 @@
+package keycloak
+
+import (
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ClaimsTransformer transforms the claims of a valid token, e.g. to rename or derive
+// claims, before they are stored in context and checked by other middlewares.
+type ClaimsTransformer func(claims jwt.MapClaims) error
+
+// RenameClaim returns a `ClaimsTransformer` renaming the claim from to the claim to.
+func RenameClaim(from, to string) ClaimsTransformer {
+	return func(claims jwt.MapClaims) error {
+		if v, ok := claims[from]; ok {
+			delete(claims, from)
+			claims[to] = v
+		}
+		return nil
+	}
+}
+
+// FlattenClaim returns a `ClaimsTransformer` copying the nested claim at the dot
+// separated path, e.g. "address.country", to the top-level claim to.
+func FlattenClaim(path, to string) ClaimsTransformer {
+	keys := strings.Split(path, ".")
+	return func(claims jwt.MapClaims) error {
+		var v interface{} = map[string]interface{}(claims)
+		for _, key := range keys {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			if v, ok = m[key]; !ok {
+				return nil
+			}
+		}
+		claims[to] = v
+		return nil
+	}
+}
+
+// DeriveClaim returns a `ClaimsTransformer` setting the claim name to the value computed
+// by derive. Nil values are not set.
+func DeriveClaim(name string, derive func(claims jwt.MapClaims) interface{}) ClaimsTransformer {
+	return func(claims jwt.MapClaims) error {
+		if v := derive(claims); v != nil {
+			claims[name] = v
+		}
+		return nil
+	}
+}
+
+// transformClaims applies transformers in order to the map claims of token. Tokens
+// with custom claims are not transformed.
+func transformClaims(token *jwt.Token, transformers []ClaimsTransformer) error {
+	claims, ok := mapClaims(token)
+	if !ok {
+		return nil
+	}
+	for _, transform := range transformers {
+		if err := transform(claims); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package keycloak
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// trustedUpstream accepts pre-validated tokens of a header set by a trusted gateway.
+type trustedUpstream struct {
+	header  string
+	proxies []*net.IPNet
+	peer    func(*http.Request) bool
+}
+
+func newTrustedUpstream(header string, cidrs []string, peer func(*http.Request) bool) *trustedUpstream {
+	t := &trustedUpstream{header: header, peer: peer}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic("echo: keycloak middleware requires valid trusted proxy cidrs: " + err.Error())
+		}
+		t.proxies = append(t.proxies, network)
+	}
+	return t
+}
+
+// token returns the token of the trusted header if the request comes from a trusted peer.
+func (t *trustedUpstream) token(c echo.Context) (string, bool) {
+	req := c.Request()
+	token := req.Header.Get(t.header)
+	if token == "" || !t.trusts(req) {
+		return "", false
+	}
+	return token, true
+}
+
+// trusts reports whether the direct peer of req is a trusted proxy or accepted by the
+// peer function, e.g. by its mTLS client certificate.
+func (t *trustedUpstream) trusts(req *http.Request) bool {
+	if t.peer != nil && t.peer(req) {
+		return true
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range t.proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package keycloak
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+func TestTrustedUpstream(t *testing.T) {
+	kc := keycloaktest.NewServer("trusted")
+	defer kc.Close()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// unverified is a token the realm did not sign, accepted from trusted gateways only.
+	unverified := func(exp time.Time) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss": kc.Issuer(), "typ": "Bearer", "exp": exp.Unix(),
+		}).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := map[string]struct {
+		remoteAddr string
+		peer       bool
+		header     string
+		bearer     string
+		forwarded  string
+		status     int
+	}{
+		"TrustedProxy":       {"10.0.0.7:4711", false, unverified(time.Now().Add(time.Minute)), "", "", http.StatusNoContent},
+		"TrustedPeer":        {"192.0.2.1:4711", true, unverified(time.Now().Add(time.Minute)), "", "", http.StatusNoContent},
+		"TrustedExpired":     {"10.0.0.7:4711", false, unverified(time.Now().Add(-time.Minute)), "", "", http.StatusUnauthorized},
+		"TrustedMalformed":   {"10.0.0.7:4711", false, "not-a-token", "", "", http.StatusUnauthorized},
+		"TrustedNoHeader":    {"10.0.0.7:4711", false, "", kc.Token(nil), "", http.StatusNoContent},
+		"Untrusted":          {"192.0.2.1:4711", false, unverified(time.Now().Add(time.Minute)), "", "", http.StatusBadRequest},
+		"UntrustedForwarded": {"192.0.2.1:4711", false, unverified(time.Now().Add(time.Minute)), "", "10.0.0.7", http.StatusBadRequest},
+		"UntrustedBearer":    {"192.0.2.1:4711", false, unverified(time.Now().Add(time.Minute)), unverified(time.Now().Add(time.Minute)), "", http.StatusUnauthorized},
+		"UntrustedValid":     {"192.0.2.1:4711", false, unverified(time.Now().Add(time.Minute)), kc.Token(nil), "", http.StatusNoContent},
+		"AddrWithoutPort":    {"10.0.0.7", false, unverified(time.Now().Add(time.Minute)), "", "", http.StatusNoContent},
+		"UnparsableAddr":     {"gateway:4711", false, unverified(time.Now().Add(time.Minute)), "", "", http.StatusBadRequest},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := testConfig(kc)
+			config.TrustedTokenHeader = "X-Forwarded-Access-Token"
+			config.TrustedProxies = []string{"10.0.0.0/8"}
+			config.TrustedPeer = func(*http.Request) bool { return test.peer }
+			e := testEcho(KeycloakWithConfig(config))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = test.remoteAddr
+			if test.header != "" {
+				req.Header.Set("X-Forwarded-Access-Token", test.header)
+			}
+			if test.bearer != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+test.bearer)
+			}
+			if test.forwarded != "" {
+				req.Header.Set(echo.HeaderXForwardedFor, test.forwarded)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != test.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, test.status, rec.Body)
+			}
+		})
+	}
+}
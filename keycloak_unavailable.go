@@ -0,0 +1,40 @@
+package keycloak
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+// Errors
+var (
+	ErrKeycloakUnavailable = echo.NewHTTPError(http.StatusServiceUnavailable, "keycloak unavailable")
+)
+
+const headerRetryAfter = "Retry-After"
+
+// unavailableError marks errors caused by an unreachable Keycloak server or a
+// "5xx" response of it.
+type unavailableError struct {
+	err error
+}
+
+func (e *unavailableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *unavailableError) Unwrap() error {
+	return e.err
+}
+
+// isUnavailable reports whether err is caused by an unavailable Keycloak server.
+func isUnavailable(err error) bool {
+	var verr *jwt.ValidationError
+	if errors.As(err, &verr) && verr.Inner != nil {
+		err = verr.Inner
+	}
+	var unavailable *unavailableError
+	return errors.As(err, &unavailable)
+}
@@ -0,0 +1,146 @@
+package keycloak
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Nerzal/gocloak/v5"
+	"github.com/dgrijalva/jwt-go"
+)
+
+type (
+	// sessionMemo memoizes lookups per Keycloak session, keyed by the sid claim,
+	// so the lookups are not repeated for every request of the same session.
+	sessionMemo struct {
+		ttl time.Duration
+
+		mu      sync.Mutex
+		entries map[string]sessionMemoEntry
+		swept   time.Time
+	}
+
+	sessionMemoEntry struct {
+		value  interface{}
+		expiry time.Time
+	}
+)
+
+func newSessionMemo(ttl time.Duration) *sessionMemo {
+	return &sessionMemo{
+		ttl:     ttl,
+		entries: make(map[string]sessionMemoEntry),
+	}
+}
+
+// get returns the memoized value of the session sid or calls lookup and memoizes its result.
+// Lookups of tokens without session are not memoized.
+func (m *sessionMemo) get(sid string, now time.Time, lookup func() (interface{}, error)) (interface{}, error) {
+	if sid == "" {
+		return lookup()
+	}
+
+	m.mu.Lock()
+	entry, ok := m.entries[sid]
+	m.mu.Unlock()
+	if ok && now.Before(entry.expiry) {
+		return entry.value, nil
+	}
+
+	value, err := lookup()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.swept) >= m.ttl {
+		m.sweepLocked(now)
+	}
+	m.entries[sid] = sessionMemoEntry{value: value, expiry: now.Add(m.ttl)}
+	return value, nil
+}
+
+// sweep removes the values expired at now and returns their number.
+func (m *sessionMemo) sweep(now time.Time) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sweepLocked(now)
+}
+
+func (m *sessionMemo) sweepLocked(now time.Time) int {
+	m.swept = now
+	n := 0
+	for id, e := range m.entries {
+		if !now.Before(e.expiry) {
+			delete(m.entries, id)
+			n++
+		}
+	}
+	return n
+}
+
+// flush removes all memoized values.
+func (m *sessionMemo) flush() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = make(map[string]sessionMemoEntry)
+}
+
+// sessionID returns the Keycloak session id of token, taken from the sid or session_state claim.
+func sessionID(token *jwt.Token) string {
+	claims, ok := mapClaims(token)
+	if !ok {
+		return ""
+	}
+	sid, _ := claimsSessionID(claims)
+	return sid
+}
+
+// claimsSessionID returns the Keycloak session id of claims, taken from the sid or
+// session_state claim.
+func claimsSessionID(claims jwt.MapClaims) (string, bool) {
+	if sid, ok := claims["sid"].(string); ok && sid != "" {
+		return sid, true
+	}
+	sid, _ := claims["session_state"].(string)
+	return sid, sid != ""
+}
+
+// userInfo returns the userinfo of the token, memoized per session. Fetching the
+// userinfo is cancelled with ctx.
+func (config *KeycloakConfig) userInfo(ctx context.Context, auth string, token *jwt.Token) (*gocloak.UserInfo, error) {
+	info, err := config.userInfoMemo.get(sessionID(token), config.Now(), func() (interface{}, error) {
+		return config.fetchUserInfo(ctx, auth)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info.(*gocloak.UserInfo), nil
+}
+
+// fetchUserInfo fetches the userinfo of auth. It replaces GetUserInfo of the gocloak
+// client, which cannot be cancelled.
+func (config *KeycloakConfig) fetchUserInfo(ctx context.Context, auth string) (*gocloak.UserInfo, error) {
+	var info gocloak.UserInfo
+	resp, err := config.gocloakClient.RestyClient().R().
+		SetContext(ctx).
+		SetAuthToken(auth).
+		SetResult(&info).
+		Get(config.oidcEndpoints().UserInfo)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &unavailableError{err: err}
+	}
+	if resp.StatusCode() >= http.StatusInternalServerError {
+		return nil, &unavailableError{err: fmt.Errorf("could not get user info: %s", resp.Status())}
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("could not get user info: %s", resp.Status())
+	}
+	return &info, nil
+}
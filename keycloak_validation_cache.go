@@ -0,0 +1,91 @@
+package keycloak
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type (
+	// validationCache caches validated tokens by their raw string until they expire,
+	// so repeated requests with the same token skip decoding and verification.
+	// Cached tokens are shared between requests and must not be modified.
+	validationCache struct {
+		size int
+
+		mu     sync.RWMutex
+		tokens map[string]validationCacheEntry
+	}
+
+	validationCacheEntry struct {
+		token  *jwt.Token
+		expiry time.Time
+	}
+)
+
+func newValidationCache(size int) *validationCache {
+	return &validationCache{
+		size:   size,
+		tokens: make(map[string]validationCacheEntry, size),
+	}
+}
+
+// get returns the cached token of raw if it is not expired at now. The token is not
+// copied, so hits do not allocate: it and its claims are shared by all requests with
+// raw and are read-only, see `KeycloakConfig.ValidationCacheSize`.
+func (c *validationCache) get(raw string, now time.Time) (*jwt.Token, bool) {
+	c.mu.RLock()
+	entry, ok := c.tokens[raw]
+	c.mu.RUnlock()
+	if !ok || !now.Before(entry.expiry) {
+		return nil, false
+	}
+	return entry.token, true
+}
+
+// put caches the validated token until its exp claim. Tokens without exp claim are not cached.
+func (c *validationCache) put(token *jwt.Token, now time.Time) {
+	_, expiry, _ := tokenIDAndExpiry(token)
+	if expiry.Unix() <= 0 || !now.Before(expiry) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.tokens) >= c.size {
+		for raw, entry := range c.tokens {
+			if !now.Before(entry.expiry) {
+				delete(c.tokens, raw)
+			}
+		}
+	}
+	if len(c.tokens) >= c.size {
+		for raw := range c.tokens {
+			delete(c.tokens, raw)
+			break
+		}
+	}
+	c.tokens[token.Raw] = validationCacheEntry{token: token, expiry: expiry}
+}
+
+// sweep removes the tokens expired at now and returns their number.
+func (c *validationCache) sweep(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for raw, entry := range c.tokens {
+		if !now.Before(entry.expiry) {
+			delete(c.tokens, raw)
+			n++
+		}
+	}
+	return n
+}
+
+// flush removes all cached tokens.
+func (c *validationCache) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens = make(map[string]validationCacheEntry, c.size)
+}
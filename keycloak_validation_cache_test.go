@@ -0,0 +1,33 @@
+package keycloak
+
+import (
+	"context"
+	"testing"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestValidationCacheHitAllocations(t *testing.T) {
+	kc := keycloaktest.NewServer("cache")
+	defer kc.Close()
+	config := testConfig(kc)
+	config.ValidationCacheSize = 10
+	v := NewVerifier(config)
+	defer v.Close()
+	token := kc.Token(jwt.MapClaims{"sub": "user"})
+
+	ctx := context.Background()
+	first, err := v.validate(ctx, token, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		if cached, err := v.validate(ctx, token, false, 0); err != nil || cached != first {
+			t.Fatalf("cache miss: %v", err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("expected no allocations for cached tokens, got %v", allocs)
+	}
+}
@@ -0,0 +1,165 @@
+package keycloak
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+// Verifier validates tokens of a realm. It holds the client, keys and caches of a
+// config, so one verifier can back multiple middlewares, e.g.:
+//
+//	verifier := keycloak.NewVerifier(config)
+//	e.Use(verifier.Middleware())
+//	admin := e.Group("/admin", verifier.RolesMiddleware("admin"))
+//
+// A Verifier can also validate tokens without echo, see `Verifier.ValidateToken()`.
+type Verifier struct {
+	// notBefore is accessed atomically and must stay 64-bit aligned.
+	notBefore int64
+
+	config    KeycloakConfig
+	extractor tokenExtractor
+
+	stop      chan struct{}
+	stopOnce  sync.Once
+	closeOnce sync.Once
+	release   []func()
+}
+
+// ValidateToken validates token like the middleware of the verifier and returns it
+// with the claims of NewClaimsFunc. Checks depending on the request, e.g. per-route
+// audiences, one-time tokens and userinfo, are not done. Fetching keys and
+// introspection are cancelled with ctx.
+func (v *Verifier) ValidateToken(ctx context.Context, token string) (*jwt.Token, error) {
+	t, err := v.validate(ctx, token, false, v.config.Leeway)
+	if err == nil && len(v.config.RequiredAudience) > 0 {
+		err = verifyAudience(t.Claims, v.config.RequiredAudience)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// RolesMiddleware returns a KeycloakRoles middleware requiring one of roles, reading
+// the token stored by the middleware of the verifier.
+func (v *Verifier) RolesMiddleware(roles ...string) echo.MiddlewareFunc {
+	c := DefaultKeycloakRolesConfig
+	c.KeycloakRoles = roles
+	c.TokenContextKey = v.config.ContextKey
+	return KeycloakRolesWithConfig(c)
+}
+
+// Close stops the background goroutines of the verifier, e.g. the key refresh of
+// KeyRefreshInterval, and releases its caches from `FlushCaches()`, its registration
+// for `Close()` and its SharedKeys, so verifiers no longer used, e.g. of removed
+// tenants, can be garbage collected. Its middlewares keep working without
+// background work.
+// See `Close()` to stop the goroutines of all verifiers.
+func (v *Verifier) Close() {
+	v.closeOnce.Do(func() {
+		v.stopBackground()
+		for _, release := range v.release {
+			release()
+		}
+	})
+}
+
+// stopBackground stops the background goroutines of the verifier.
+func (v *Verifier) stopBackground() {
+	v.stopOnce.Do(func() {
+		close(v.stop)
+	})
+}
+
+// flush empties the caches of the verifier, see `FlushCaches()`. Revocations are kept.
+func (v *Verifier) flush() {
+	config := &v.config
+	config.keySet.flush()
+	if config.validationCache != nil {
+		config.validationCache.flush()
+	}
+	if config.introspectionCache != nil {
+		config.introspectionCache.flush()
+	}
+	if config.userInfoMemo != nil {
+		config.userInfoMemo.flush()
+	}
+	if config.enrichmentMemo != nil {
+		config.enrichmentMemo.flush()
+	}
+	if config.activeSessions != nil {
+		config.activeSessions.flush()
+	}
+	if config.sessionClaims != nil {
+		config.sessionClaims.flush()
+	}
+	if cache, ok := config.TokenCache.(*memoryCache); ok {
+		cache.flush()
+	}
+}
+
+// validate validates auth with the verifier, without the checks depending on the
+// request like per-route audiences. Tokens of a trusted upstream are not verified
+// again. Fetching keys and introspection are cancelled with ctx.
+func (v *Verifier) validate(ctx context.Context, auth string, trusted bool, leeway time.Duration) (*jwt.Token, error) {
+	config := &v.config
+	var err error
+	token, cached := (*jwt.Token)(nil), false
+	if config.PreFilter != nil && !trusted {
+		err = config.PreFilter(auth)
+	}
+	if err == nil && config.validationCache != nil {
+		token, cached = config.validationCache.get(auth, config.Now())
+	}
+	if err == nil && !cached && !trusted && config.introspectionCache != nil {
+		token, cached, err = config.introspectionCache.get(auth, config.Now())
+	}
+	cacheTTL := config.IntrospectionCacheTTL
+	if err == nil && !cached {
+		claims := config.NewClaimsFunc()
+		if config.ValidationMode == IntrospectionValidation && !trusted {
+			token, cacheTTL, err = config.introspectToken(ctx, auth, claims)
+			if isUnavailable(err) && config.introspectionFallback() && strings.Count(auth, ".") == 2 {
+				if local, lerr := config.decodeToken(ctx, auth, claims, true, leeway); !isUnavailable(lerr) {
+					token, err = local, lerr
+				}
+			}
+		} else {
+			token, err = config.decodeToken(ctx, auth, claims, !trusted, leeway)
+		}
+		if err == nil && token.Valid {
+			err = verifyTokenType(token.Claims, config.AllowedTokenTypes, config.AllowMissingTokenType)
+		}
+		if err == nil && token.Valid && config.ValidateIssuer {
+			err = config.verifyIssuer(token.Claims)
+		}
+		if err == nil && token.Valid && len(config.AllowedAuthorizedParties) > 0 {
+			err = verifyAuthorizedParty(token.Claims, config.AllowedAuthorizedParties)
+		}
+		if err == nil && token.Valid && len(config.ClaimsTransformers) > 0 {
+			err = transformClaims(token, config.ClaimsTransformers)
+		}
+		if err == nil && token.Valid && !trusted && config.validationCache != nil {
+			config.validationCache.put(token, config.Now())
+		}
+		if !trusted && config.introspectionCache != nil {
+			config.introspectionCache.put(auth, token, err, cacheTTL, config.Now())
+		}
+	}
+	if err == nil && token.Valid {
+		err = v.verifyNotBefore(token.Claims)
+	}
+	if err == nil && token.Valid {
+		err = v.verifyRevocation(token.Claims)
+	}
+	if err == nil && token.Valid && config.activeSessions != nil {
+		err = config.verifyActiveSession(ctx, auth, token)
+	}
+	return token, err
+}
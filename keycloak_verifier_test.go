@@ -0,0 +1,93 @@
+package keycloak
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestVerifierCloseReleasesCacheFlusher(t *testing.T) {
+	kc := keycloaktest.NewServer("close")
+	defer kc.Close()
+	flushers := func() int {
+		cacheFlushersMu.Lock()
+		defer cacheFlushersMu.Unlock()
+		return len(cacheFlushers)
+	}
+	before := flushers()
+
+	config := testConfig(kc)
+	config.ValidationCacheSize = 10
+	v := NewVerifier(config)
+	token := kc.Token(jwt.MapClaims{"sub": "user"})
+	if _, err := v.ValidateToken(context.Background(), token); err != nil {
+		t.Fatal(err)
+	}
+	FlushCaches()
+	if _, cached := v.config.validationCache.get(token, v.config.Now()); cached {
+		t.Fatal("FlushCaches did not flush the validation cache")
+	}
+
+	v.Close()
+	if n := flushers(); n != before {
+		t.Fatalf("expected %d cache flushers after Close, got %d", before, n)
+	}
+}
+
+func TestVerifierCloseReleasesCloser(t *testing.T) {
+	kc := keycloaktest.NewServer("close")
+	defer kc.Close()
+	registered := func() int {
+		closersMu.Lock()
+		defer closersMu.Unlock()
+		return len(closers)
+	}
+	before := registered()
+
+	config := testConfig(kc)
+	config.SweepInterval = time.Hour
+	v := NewVerifier(config)
+	if n := registered(); n != before+1 {
+		t.Fatalf("expected %d closers, got %d", before+1, n)
+	}
+	v.Close()
+	if n := registered(); n != before {
+		t.Fatalf("expected %d closers after Close, got %d", before, n)
+	}
+	select {
+	case <-v.stop:
+	default:
+		t.Fatal("Close did not stop the background goroutines")
+	}
+}
+
+func TestVerifierCloseReleasesSharedKeys(t *testing.T) {
+	kc := keycloaktest.NewServer("close")
+	defer kc.Close()
+	config := testConfig(kc)
+	config.SharedKeys = true
+	jwks := config.oidcEndpoints().JWKS
+	shared := func() (*sharedKeys, bool) {
+		sharedKeySetsMu.Lock()
+		defer sharedKeySetsMu.Unlock()
+		k, ok := sharedKeySets[jwks]
+		return k, ok
+	}
+
+	first, second := NewVerifier(config), NewVerifier(config)
+	if first.config.keySet != second.config.keySet {
+		t.Fatal("verifiers do not share keys")
+	}
+	first.Close()
+	first.Close()
+	if k, ok := shared(); !ok || k.refs != 1 {
+		t.Fatal("shared keys released while in use")
+	}
+	second.Close()
+	if _, ok := shared(); ok {
+		t.Fatal("shared keys not released after all verifiers closed")
+	}
+}
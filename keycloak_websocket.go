@@ -0,0 +1,147 @@
+package keycloak
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+// CloseCodePolicyViolation is the WebSocket close code for connections whose
+// authorization lapsed (RFC 6455, section 7.4.1).
+const CloseCodePolicyViolation = 1008
+
+// Errors
+var (
+	ErrTokenExpired = errors.New("token expired")
+)
+
+type (
+	// ConnectionGuardConfig defines the config for a ConnectionGuard.
+	ConnectionGuardConfig struct {
+		// TokenContextKey is the context key which stores the keycloak jwt token
+		// Optional. Default value is the ContextKey of the verifier.
+		TokenContextKey string
+
+		// Roles defines the roles the token must have, checked like by the roles
+		// middleware with this config, e.g. with RoleSource, MatchMode and role
+		// templates filled in with the path parameters of the request.
+		// Optional. Default is no role check.
+		Roles *KeycloakRolesConfig
+
+		// Now defines the time source used to check the expiry of the token.
+		// Optional. Default value time.Now.
+		Now func() time.Time
+	}
+
+	// ConnectionGuard re-checks the authorization of a long-lived connection, e.g. a
+	// WebSocket, for which the Keycloak middleware only validated the token on connect.
+	ConnectionGuard struct {
+		verifier *Verifier
+		token    *jwt.Token
+		expiry   time.Time
+		config   ConnectionGuardConfig
+	}
+)
+
+// NewConnectionGuard returns a ConnectionGuard for the token in the context of a
+// request passed by the middleware of verifier, e.g. the upgrade request of a
+// WebSocket. It fails if the token is already unauthorized.
+//
+// The roles are checked once, as neither the token nor the request change during the
+// connection. Check re-runs the checks of verifier which may lapse later.
+func NewConnectionGuard(c echo.Context, verifier *Verifier, config ConnectionGuardConfig) (*ConnectionGuard, error) {
+	if verifier == nil {
+		panic("echo: keycloak connection guard requires a verifier")
+	}
+	if config.TokenContextKey == "" {
+		config.TokenContextKey = verifier.config.ContextKey
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	token, ok := contextToken(c, config.TokenContextKey)
+	if !ok {
+		return nil, ErrClaimsMissing
+	}
+	claims, ok := mapClaims(token)
+	if !ok {
+		return nil, ErrClaimsMissing
+	}
+	if config.Roles != nil {
+		if _, err := newRolesCheck(*config.Roles).check(c, claims); err != nil {
+			return nil, err
+		}
+	}
+	_, expiry, _ := claimsIDAndExpiry(claims)
+	g := &ConnectionGuard{verifier: verifier, token: token, expiry: expiry, config: config}
+	return g, g.CheckContext(c.Request().Context())
+}
+
+// Check returns an error if the token expired, was revoked, is issued before the
+// not-before policy of the verifier or its Keycloak session ended, if the verifier
+// checks active sessions. It should be called for each inbound message.
+func (g *ConnectionGuard) Check() error {
+	return g.CheckContext(context.Background())
+}
+
+// CheckContext is Check, checking the Keycloak session is cancelled with ctx.
+func (g *ConnectionGuard) CheckContext(ctx context.Context) error {
+	if g.expiry.Unix() > 0 && !g.config.Now().Before(g.expiry) {
+		return ErrTokenExpired
+	}
+	if err := g.verifier.verifyNotBefore(g.token.Claims); err != nil {
+		return err
+	}
+	if err := g.verifier.verifyRevocation(g.token.Claims); err != nil {
+		return err
+	}
+	if g.verifier.config.activeSessions != nil {
+		return g.verifier.config.verifyActiveSession(ctx, g.token.Raw, g.token)
+	}
+	return nil
+}
+
+// Watch calls Check every interval until ctx is done and calls closeConn with
+// `CloseCodePolicyViolation` and the reason once the authorization lapsed.
+func (g *ConnectionGuard) Watch(ctx context.Context, interval time.Duration, closeConn func(code int, reason string)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := g.CheckContext(ctx); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				closeConn(CloseCodePolicyViolation, errorMessage(err))
+				return
+			}
+		}
+	}
+}
+
+// contextToken returns the token stored in the context of c at key or in its AuthContext.
+func contextToken(c echo.Context, key string) (*jwt.Token, bool) {
+	if token, ok := c.Get(key).(*jwt.Token); ok && token != nil && token.Valid {
+		return token, true
+	}
+	if auth, ok := AuthFromContext(c); ok {
+		return auth.Token, true
+	}
+	return nil, false
+}
+
+// errorMessage returns the message of err without status code.
+func errorMessage(err error) string {
+	if he, ok := err.(*echo.HTTPError); ok {
+		if message, ok := he.Message.(string); ok {
+			return message
+		}
+	}
+	return err.Error()
+}
@@ -0,0 +1,65 @@
+package keycloak
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/baba2k/echo-keycloak/keycloaktest"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+func TestConnectionGuard(t *testing.T) {
+	kc := keycloaktest.NewServer("guard")
+	defer kc.Close()
+	config := testConfig(kc)
+	config.Revocation = true
+	v := NewVerifier(config)
+	defer v.Close()
+
+	roles := DefaultKeycloakRolesConfig
+	roles.KeycloakRoles = []string{"org:{org}:member", "chat"}
+	roles.MatchMode = MatchAll
+
+	tests := map[string]struct {
+		org   string
+		roles []interface{}
+		err   error
+	}{
+		"Authorized":       {"acme", []interface{}{"org:acme:member", "chat"}, nil},
+		"OtherOrg":         {"other", []interface{}{"org:acme:member", "chat"}, ErrRolesInvalid},
+		"MissingRole":      {"acme", []interface{}{"org:acme:member"}, ErrRolesInvalid},
+		"MissingTemplated": {"acme", []interface{}{"chat"}, ErrRolesInvalid},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			token, err := v.ValidateToken(context.Background(), kc.Token(jwt.MapClaims{
+				"sid":          name,
+				"realm_access": map[string]interface{}{"roles": test.roles},
+			}))
+			if err != nil {
+				t.Fatalf("ValidateToken() = %v", err)
+			}
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+			c.SetParamNames("org")
+			c.SetParamValues(test.org)
+			c.Set("user", token)
+
+			g, err := NewConnectionGuard(c, v, ConnectionGuardConfig{Roles: &roles})
+			if err != test.err {
+				t.Fatalf("NewConnectionGuard() = %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			if err := v.RevokeSession(name); err != nil {
+				t.Fatalf("RevokeSession() = %v", err)
+			}
+			if err := g.Check(); err != ErrTokenRevoked {
+				t.Errorf("Check() of revoked session = %v, want %v", err, ErrTokenRevoked)
+			}
+		})
+	}
+}
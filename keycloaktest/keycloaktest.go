@@ -0,0 +1,212 @@
+// Package keycloaktest provides a mock Keycloak server for tests and benchmarks of
+// the echo-keycloak middlewares.
+package keycloaktest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Server is a mock Keycloak server serving a realm with its signing keys and issuing
+// signed access tokens.
+type Server struct {
+	*httptest.Server
+
+	// Realm is the name of the realm served.
+	Realm string
+
+	mu           sync.RWMutex
+	key          *rsa.PrivateKey
+	kid          string
+	passive      map[string]*rsa.PrivateKey
+	keys         uint64
+	certRequests uint64
+	export       *RealmExport
+}
+
+// NewServer starts and returns a new mock Keycloak server serving realm.
+// The caller should call Close when finished, to shut it down.
+func NewServer(realm string) *Server {
+	s := &Server{Realm: realm}
+	s.key, s.kid = s.newKey()
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// RotateKey replaces the signing key of the realm by a new key with a new key id.
+// The previous keys are no longer published, so middlewares must fetch the keys again
+// to verify tokens issued afterwards.
+func (s *Server) RotateKey() {
+	key, kid := s.newKey()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.key = key
+	s.kid = kid
+	s.passive = nil
+}
+
+// RotateKeyGracefully replaces the signing key like `Server.RotateKey()`, but keeps
+// publishing the previous key as passive key like Keycloak does, so tokens signed
+// before the rotation stay valid during a grace period ended by `Server.RetireKeys()`.
+func (s *Server) RotateKeyGracefully() {
+	key, kid := s.newKey()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.passive == nil {
+		s.passive = make(map[string]*rsa.PrivateKey)
+	}
+	s.passive[s.kid] = s.key
+	s.key = key
+	s.kid = kid
+}
+
+// RetireKeys stops publishing the passive keys of `Server.RotateKeyGracefully()`.
+func (s *Server) RetireKeys() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.passive = nil
+}
+
+// KeyID returns the key id of the current signing key.
+func (s *Server) KeyID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.kid
+}
+
+// CertRequests returns the number of requests of the certs endpoint.
+func (s *Server) CertRequests() uint64 {
+	return atomic.LoadUint64(&s.certRequests)
+}
+
+// newKey generates a new signing key with a new key id.
+func (s *Server) newKey() (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic("keycloaktest: failed to generate key: " + err.Error())
+	}
+	return key, "key-" + strconv.FormatUint(atomic.AddUint64(&s.keys, 1), 10)
+}
+
+// Issuer returns the issuer URL of the realm.
+func (s *Server) Issuer() string {
+	return s.URL + "/auth/realms/" + s.Realm
+}
+
+// Token returns an access token signed by the current key of the realm. The claims
+// exp, iat, iss, jti and typ are set unless they are given. Claims given as nil are
+// omitted.
+func (s *Server) Token(claims jwt.MapClaims) string {
+	now := time.Now()
+	c := jwt.MapClaims{
+		"exp": now.Add(5 * time.Minute).Unix(),
+		"iat": now.Unix(),
+		"iss": s.Issuer(),
+		"jti": strconv.FormatInt(now.UnixNano(), 36),
+		"typ": "Bearer",
+	}
+	for k, v := range claims {
+		c[k] = v
+		if v == nil {
+			delete(c, k)
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, c)
+	token.Header["kid"] = s.kid
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		panic("keycloaktest: failed to sign token: " + err.Error())
+	}
+	return signed
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	realmPath := "/auth/realms/" + s.Realm
+	switch {
+	case r.URL.Path == realmPath:
+		writeJSON(w, map[string]interface{}{
+			"realm":         s.Realm,
+			"token-service": s.Issuer() + "/protocol/openid-connect",
+		})
+	case r.URL.Path == realmPath+"/.well-known/openid-configuration":
+		writeJSON(w, map[string]interface{}{
+			"issuer":   s.Issuer(),
+			"jwks_uri": s.Issuer() + "/protocol/openid-connect/certs",
+		})
+	case r.URL.Path == realmPath+"/protocol/openid-connect/certs":
+		atomic.AddUint64(&s.certRequests, 1)
+		writeJSON(w, map[string]interface{}{"keys": s.jwks()})
+	case r.URL.Path == realmPath+"/protocol/openid-connect/token" && r.Method == http.MethodPost:
+		s.exchangeToken(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// exchangeToken answers a token exchange with a token of the requested audience and
+// scopes for the client. Subject tokens are not verified.
+func (s *Server) exchangeToken(w http.ResponseWriter, r *http.Request) {
+	if r.PostFormValue("grant_type") != "urn:ietf:params:oauth:grant-type:token-exchange" ||
+		r.PostFormValue("subject_token") == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]string{"error": "invalid_request"})
+		return
+	}
+	claims := jwt.MapClaims{"azp": r.PostFormValue("client_id")}
+	if audience := r.PostFormValue("audience"); audience != "" {
+		claims["aud"] = audience
+	}
+	if scope := r.PostFormValue("scope"); scope != "" {
+		claims["scope"] = scope
+	}
+	writeJSON(w, map[string]interface{}{
+		"access_token": s.Token(claims),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+	})
+}
+
+// jwks returns the public keys of the current signing key and the passive keys as
+// JSON web keys.
+func (s *Server) jwks() []map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := []map[string]string{jwk(s.kid, s.key)}
+	for kid, key := range s.passive {
+		keys = append(keys, jwk(kid, key))
+	}
+	return keys
+}
+
+// jwk returns the public key of key as JSON web key.
+func jwk(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kid": kid,
+		"kty": "RSA",
+		"alg": "RS256",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
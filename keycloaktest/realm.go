@@ -0,0 +1,242 @@
+package keycloaktest
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type (
+	// RealmExport is the part of a Keycloak realm export (e.g. of "kc.sh export" or
+	// "Realm settings > Partial export") used to derive the users, roles and clients
+	// of a mock realm, see `NewServerFromExport()`.
+	RealmExport struct {
+		Realm   string         `json:"realm"`
+		Roles   ExportRoles    `json:"roles"`
+		Groups  []ExportGroup  `json:"groups"`
+		Users   []ExportUser   `json:"users"`
+		Clients []ExportClient `json:"clients"`
+	}
+
+	// ExportRoles are the realm roles and the client roles by client id of a realm export.
+	ExportRoles struct {
+		Realm  []ExportRole            `json:"realm"`
+		Client map[string][]ExportRole `json:"client"`
+	}
+
+	// ExportRole is a role of a realm export. Composite roles include their composites.
+	ExportRole struct {
+		Name       string `json:"name"`
+		Composite  bool   `json:"composite"`
+		Composites struct {
+			Realm  []string            `json:"realm"`
+			Client map[string][]string `json:"client"`
+		} `json:"composites"`
+	}
+
+	// ExportGroup is a group of a realm export. Members of a group have the roles of
+	// the group and of its parent groups.
+	ExportGroup struct {
+		Name        string              `json:"name"`
+		Path        string              `json:"path"`
+		RealmRoles  []string            `json:"realmRoles"`
+		ClientRoles map[string][]string `json:"clientRoles"`
+		SubGroups   []ExportGroup       `json:"subGroups"`
+	}
+
+	// ExportUser is a user of a realm export. Service account users have a
+	// ServiceAccountClientID.
+	ExportUser struct {
+		ID                     string              `json:"id"`
+		Username               string              `json:"username"`
+		Email                  string              `json:"email"`
+		FirstName              string              `json:"firstName"`
+		LastName               string              `json:"lastName"`
+		RealmRoles             []string            `json:"realmRoles"`
+		ClientRoles            map[string][]string `json:"clientRoles"`
+		Groups                 []string            `json:"groups"`
+		ServiceAccountClientID string              `json:"serviceAccountClientId"`
+	}
+
+	// ExportClient is a client of a realm export.
+	ExportClient struct {
+		ID                     string `json:"id"`
+		ClientID               string `json:"clientId"`
+		PublicClient           bool   `json:"publicClient"`
+		ServiceAccountsEnabled bool   `json:"serviceAccountsEnabled"`
+	}
+
+	// roleSet collects realm roles and client roles by client id.
+	roleSet struct {
+		realm  map[string]struct{}
+		client map[string]map[string]struct{}
+	}
+)
+
+// LoadRealmExport reads a realm export in JSON from r.
+func LoadRealmExport(r io.Reader) (*RealmExport, error) {
+	var export RealmExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// LoadRealmExportFile reads a realm export in JSON from the file name.
+func LoadRealmExportFile(name string) (*RealmExport, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadRealmExport(f)
+}
+
+// NewServerFromExport starts and returns a new mock Keycloak server serving the realm
+// of export, issuing tokens of its users with `Server.UserToken()` and of its service
+// accounts with `Server.ServiceAccountToken()`, so test fixtures stay in sync with the
+// real realm configuration.
+// The caller should call Close when finished, to shut it down.
+func NewServerFromExport(export *RealmExport) *Server {
+	s := NewServer(export.Realm)
+	s.export = export
+	return s
+}
+
+// UserToken returns an access token of the user with username of the realm export,
+// issued to the client clientID. Its realm_access, resource_access and groups claims
+// contain the roles and groups of the user, including roles of groups and composite
+// roles. It panics if the server has no realm export or the user is not found.
+func (s *Server) UserToken(username, clientID string) string {
+	user := s.exportUser(func(u *ExportUser) bool {
+		return u.Username == username
+	}, "user "+username)
+	return s.Token(s.exportClaims(user, clientID))
+}
+
+// ServiceAccountToken returns an access token of the service account of the client
+// clientID of the realm export, see `Server.UserToken()`.
+func (s *Server) ServiceAccountToken(clientID string) string {
+	user := s.exportUser(func(u *ExportUser) bool {
+		return u.ServiceAccountClientID == clientID
+	}, "service account of client "+clientID)
+	claims := s.exportClaims(user, clientID)
+	claims["clientId"] = clientID
+	return s.Token(claims)
+}
+
+// exportUser returns the user of the realm export matching match.
+func (s *Server) exportUser(match func(u *ExportUser) bool, name string) *ExportUser {
+	if s.export == nil {
+		panic("keycloaktest: server has no realm export")
+	}
+	for i := range s.export.Users {
+		if match(&s.export.Users[i]) {
+			return &s.export.Users[i]
+		}
+	}
+	panic("keycloaktest: realm export has no " + name)
+}
+
+// exportClaims returns the claims of user issued to clientID.
+func (s *Server) exportClaims(user *ExportUser, clientID string) jwt.MapClaims {
+	roles := roleSet{realm: make(map[string]struct{}), client: make(map[string]map[string]struct{})}
+	roles.add(s.export, user.RealmRoles, user.ClientRoles)
+	groups := make([]interface{}, 0, len(user.Groups))
+	for _, path := range user.Groups {
+		groups = append(groups, path)
+		for _, g := range groupChain(s.export.Groups, path) {
+			roles.add(s.export, g.RealmRoles, g.ClientRoles)
+		}
+	}
+
+	resourceAccess := make(map[string]interface{}, len(roles.client))
+	for client, names := range roles.client {
+		resourceAccess[client] = map[string]interface{}{"roles": roleNames(names)}
+	}
+	claims := jwt.MapClaims{
+		"sub":                user.ID,
+		"preferred_username": user.Username,
+		"azp":                clientID,
+		"realm_access":       map[string]interface{}{"roles": roleNames(roles.realm)},
+		"resource_access":    resourceAccess,
+		"groups":             groups,
+	}
+	if user.Email != "" {
+		claims["email"] = user.Email
+	}
+	if name := strings.TrimSpace(user.FirstName + " " + user.LastName); name != "" {
+		claims["name"] = name
+	}
+	return claims
+}
+
+// add adds the realm roles and client roles by client id and their composites.
+func (r roleSet) add(export *RealmExport, realm []string, client map[string][]string) {
+	for _, name := range realm {
+		if _, ok := r.realm[name]; ok {
+			continue
+		}
+		r.realm[name] = struct{}{}
+		if role, ok := findRole(export.Roles.Realm, name); ok && role.Composite {
+			r.add(export, role.Composites.Realm, role.Composites.Client)
+		}
+	}
+	for clientID, names := range client {
+		if r.client[clientID] == nil {
+			r.client[clientID] = make(map[string]struct{})
+		}
+		for _, name := range names {
+			if _, ok := r.client[clientID][name]; ok {
+				continue
+			}
+			r.client[clientID][name] = struct{}{}
+			if role, ok := findRole(export.Roles.Client[clientID], name); ok && role.Composite {
+				r.add(export, role.Composites.Realm, role.Composites.Client)
+			}
+		}
+	}
+}
+
+// findRole returns the role name of roles.
+func findRole(roles []ExportRole, name string) (ExportRole, bool) {
+	for _, role := range roles {
+		if role.Name == name {
+			return role, true
+		}
+	}
+	return ExportRole{}, false
+}
+
+// groupChain returns the group with path and its parent groups.
+func groupChain(groups []ExportGroup, path string) []ExportGroup {
+	for _, g := range groups {
+		if g.Path == path {
+			return []ExportGroup{g}
+		}
+		if strings.HasPrefix(path, g.Path+"/") {
+			if chain := groupChain(g.SubGroups, path); chain != nil {
+				return append(chain, g)
+			}
+		}
+	}
+	return nil
+}
+
+// roleNames returns the sorted names of set as JSON array.
+func roleNames(set map[string]struct{}) []interface{} {
+	sorted := make([]string, 0, len(set))
+	for name := range set {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	names := make([]interface{}, len(sorted))
+	for i, name := range sorted {
+		names[i] = name
+	}
+	return names
+}
@@ -0,0 +1,41 @@
+package keycloaktest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// VerifyKeyRotation checks that handler, protected by a Keycloak middleware of the realm
+// of s, accepts tokens signed after a key rotation without waiting for a scheduled key
+// refresh. It sends a request with a valid token, rotates the key and sends a request
+// with a token signed by the new key. Both requests must succeed with a 2xx status.
+//
+// It is meant to be reused by tests of protected applications, e.g.
+//
+//	if err := keycloaktest.VerifyKeyRotation(kc, e, "/protected", claims); err != nil {
+//		t.Fatal(err)
+//	}
+func VerifyKeyRotation(s *Server, handler http.Handler, path string, claims jwt.MapClaims) error {
+	if err := verifyRequest(handler, path, s.Token(claims)); err != nil {
+		return fmt.Errorf("before key rotation: %v", err)
+	}
+	s.RotateKey()
+	if err := verifyRequest(handler, path, s.Token(claims)); err != nil {
+		return fmt.Errorf("after key rotation to %q: %v", s.KeyID(), err)
+	}
+	return nil
+}
+
+func verifyRequest(handler http.Handler, path, token string) error {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code < 200 || rec.Code > 299 {
+		return fmt.Errorf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	return nil
+}